@@ -0,0 +1,62 @@
+package mbox
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// AtomicWriter appends mail to an mbox file such that a failure part way
+// through a message never leaves a partial message behind.  Use
+// NewAtomicWriter to instantiate.  Set Type and FS through the embedded
+// MboxWriter, just as with NewWriter.
+type AtomicWriter struct {
+	*MboxWriter
+	File *os.File // The mbox file receiving the mail.
+}
+
+// NewAtomicWriter instantiates a new AtomicWriter appending to file.
+func NewAtomicWriter(file *os.File) (result *AtomicWriter) {
+	return &AtomicWriter{MboxWriter: NewWriter(file), File: file}
+}
+
+// WriteMail appends the mail to the end of the file, just as
+// MboxWriter.WriteMail does.  It syncs the file to storage once the whole
+// message has been written.  If anything fails along the way, it truncates
+// the file back to the size it had before the call, so the mbox never holds a
+// half-written message.
+func (a *AtomicWriter) WriteMail(from string, mail io.Reader) (err error) {
+	start, err := a.File.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	err = a.MboxWriter.WriteMail(from, mail)
+	if err == nil {
+		err = a.File.Sync()
+	}
+	if err != nil {
+		return a.rollback(start, err)
+	}
+	return nil
+}
+
+// rollback truncates the file to start, reporting cause along with any
+// failure to roll back.
+func (a *AtomicWriter) rollback(start int64, cause error) (err error) {
+	err = a.File.Truncate(start)
+	if err == nil {
+		_, err = a.File.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		return fmt.Errorf("%s (and failed to roll back to %d: %s)", cause, start, err)
+	}
+	return cause
+}
+
+// AtomicWriter provides an AtomicWriter of the given type that appends to the
+// end of the locked mbox.
+func (l *LockedMailbox) AtomicWriter(mboxType int) (result *AtomicWriter) {
+	result = NewAtomicWriter(l.File)
+	result.Type = mboxType
+	return result
+}
@@ -0,0 +1,94 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestAtomicWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mType := range []int{MBOXO, MBOXRD, MBOXCL, MBOXCL2} {
+		file, err := os.OpenFile(path, os.O_RDWR, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, err := file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer := NewAtomicWriter(file)
+		writer.Type = mType
+
+		// Fail part way through the body.
+		broken := io.MultiReader(bytes.NewBufferString(email2[:60]), iotest.ErrReader(fmt.Errorf("never gonna give you up")))
+		err = writer.WriteMail(from2, broken)
+		if err == nil {
+			t.Errorf("type %d: expected an error, but it worked", mType)
+		}
+		after, err := file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Size() != before.Size() {
+			t.Errorf("type %d: expected size %d after rollback but got %d", mType, before.Size(), after.Size())
+		}
+
+		err = writer.WriteMail(from3, bytes.NewBuffer([]byte(email3)))
+		if err != nil {
+			t.Errorf("type %d: %s", mType, err)
+		}
+		file.Close()
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box := NewReader(bytes.NewReader(b))
+	count := 0
+	for box.Next() {
+		count++
+	}
+	if count != 6 {
+		t.Errorf("expected 6 messages but got %d", count)
+	}
+}
+
+func TestLockedMailboxAtomicWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := OpenLocked(path, os.O_RDWR, 0600, &LockOptions{Methods: []LockMethod{LockDotlock}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer box.Close()
+	writer := box.AtomicWriter(MBOXRD)
+	if writer.Type != MBOXRD {
+		t.Errorf("expected type %d but got %d", MBOXRD, writer.Type)
+	}
+	err = writer.WriteMail(from4, bytes.NewBuffer([]byte(email4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := mboxo + "From " + from4 + "\n" + strings.Replace(email4, ">From", ">>From", 1) + "\n"
+	CompareBodies(expected, string(b), t)
+}
@@ -0,0 +1,239 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppleMailbox describes an mbox exported by Apple Mail, which writes a
+// directory named like 'Foo.mbox' holding the messages in a file named 'mbox'
+// along with a 'table_of_contents' file of its own.  Use OpenAppleMailbox to
+// instantiate.
+type AppleMailbox struct {
+	File *os.File // The open mbox file within the bundle.
+	Path string   // The path to the bundle directory.
+}
+
+// emlxFlags maps the bits of the 'flags' property in an .emlx file to flags.
+var emlxFlags = []struct {
+	bit  int64
+	flag Flags
+}{
+	{1 << 0, FlagRead | FlagOld},
+	{1 << 1, FlagDeleted},
+	{1 << 2, FlagAnswered},
+	{1 << 4, FlagFlagged},
+	{1 << 6, FlagDraft},
+}
+
+// Emlx describes a single message read from an .emlx file, the format Apple
+// Mail uses to store each message.  The file holds a line with the length of
+// the message, the message itself, then an XML property list describing it.
+type Emlx struct {
+	From       string            // A 'From ' line built from the message's 'Return-Path' header and the time Apple Mail received it.
+	Received   time.Time         // The 'date-received' property, or the 'Date' header if that's missing.
+	Flags      Flags             // The flags recorded in the 'flags' property.
+	Properties map[string]string // The simple values in the property list, by key, as text.
+	raw        []byte
+}
+
+// OpenAppleMailbox opens the mbox within the Apple Mail export bundle at path.
+func OpenAppleMailbox(path string) (result *AppleMailbox, err error) {
+	file, err := os.Open(filepath.Join(path, "mbox"))
+	if err != nil {
+		return nil, err
+	}
+	return &AppleMailbox{File: file, Path: path}, nil
+}
+
+// Reader provides an MboxReader of the given type that reads the bundle's mbox
+// from the beginning.  Use DetectType on File when unsure of the type.
+func (a *AppleMailbox) Reader(mboxType int) (result *MboxReader, err error) {
+	_, err = a.File.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	result = NewReader(a.File)
+	result.Type = mboxType
+	return result, nil
+}
+
+// Close closes the bundle's mbox.
+func (a *AppleMailbox) Close() error {
+	return a.File.Close()
+}
+
+// ReadEmlx reads a message from an .emlx file.
+func ReadEmlx(read io.Reader) (result *Emlx, err error) {
+	reader := bufio.NewReader(read)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the emlx message length: %s", err)
+	}
+	length, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid emlx message length %q", strings.TrimSpace(line))
+	}
+	raw := make([]byte, length)
+	_, err = io.ReadFull(reader, raw)
+	if err != nil {
+		return nil, fmt.Errorf("emlx message shorter than its length of %d: %s", length, err)
+	}
+	plist, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	result = &Emlx{Properties: map[string]string{}, raw: raw}
+	if len(bytes.TrimSpace(plist)) > 0 {
+		result.Properties, err = parsePlistDict(plist)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the emlx property list: %s", err)
+		}
+	}
+	if flags, err := strconv.ParseInt(result.Properties["flags"], 10, 64); err == nil {
+		for _, f := range emlxFlags {
+			if flags&f.bit != 0 {
+				result.Flags |= f.flag
+			}
+		}
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if received, err := strconv.ParseFloat(result.Properties["date-received"], 64); err == nil {
+		result.Received = time.Unix(int64(received), 0)
+	} else if date, err := msg.Header.Date(); err == nil {
+		result.Received = date
+	}
+	result.From = senderFrom(msg.Header, result.Received)
+	return result, nil
+}
+
+// Reader provides the message, with 'Status' and 'X-Status' headers recording
+// its flags, suitable for handing to MboxWriter.WriteMail along with the From
+// field.
+func (e *Emlx) Reader() io.Reader {
+	return bytes.NewReader(withFlags(e.raw, e.Flags, 0))
+}
+
+// parsePlistDict reads the top-level dictionary of an XML property list,
+// keeping the text of each simple value and skipping arrays and nested
+// dictionaries.  Booleans become 'true' or 'false'.
+func parsePlistDict(data []byte) (result map[string]string, err error) {
+	result = map[string]string{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Find the dictionary.
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "dict" {
+			break
+		}
+	}
+	key := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.EndElement:
+			// The dictionary is done.
+			return result, nil
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "key":
+				err = decoder.DecodeElement(&key, &t)
+			case "array", "dict", "data":
+				err = decoder.Skip()
+			case "true", "false":
+				result[key] = t.Name.Local
+				err = decoder.Skip()
+			default:
+				value := ""
+				err = decoder.DecodeElement(&value, &t)
+				result[key] = strings.TrimSpace(value)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// emlxEntry describes an .emlx file found by ImportEmlx.
+type emlxEntry struct {
+	path     string
+	received time.Time
+}
+
+// ImportEmlx writes each message in the .emlx files found under root to
+// writer, oldest first by the time Apple Mail received them.  It searches
+// every directory beneath root, as Apple Mail spreads a mailbox's messages
+// across several.  It returns the number of messages imported.
+func ImportEmlx(root string, writer *MboxWriter) (count int, err error) {
+	entries := []emlxEntry{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".emlx") {
+			return err
+		}
+		msg, err := readEmlxFile(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, emlxEntry{path: path, received: msg.Received})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].received.Equal(entries[j].received) {
+			return entries[i].path < entries[j].path
+		}
+		return entries[i].received.Before(entries[j].received)
+	})
+
+	// We read each file again rather than holding every message in memory.
+	for _, entry := range entries {
+		msg, err := readEmlxFile(entry.path)
+		if err != nil {
+			return count, err
+		}
+		err = writer.WriteMail(msg.From, msg.Reader())
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// readEmlxFile reads the .emlx file at path.
+func readEmlxFile(path string) (result *Emlx, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	result, err = ReadEmlx(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", path, err)
+	}
+	return result, nil
+}
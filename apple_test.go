@@ -0,0 +1,151 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// emlxFile builds the contents of an .emlx file holding the message.
+func emlxFile(message string, received int64, flags int64) string {
+	return fmt.Sprintf("%d        \n%s", len(message), message) + `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>date-received</key>
+	<integer>` + fmt.Sprint(received) + `</integer>
+	<key>flags</key>
+	<integer>` + fmt.Sprint(flags) + `</integer>
+	<key>remote-id</key>
+	<string>4242</string>
+	<key>to</key>
+	<array>
+		<string>mrmxpdstk@lazytown.com</string>
+	</array>
+	<key>conversation-id</key>
+	<integer>77</integer>
+	<key>partial</key>
+	<false/>
+</dict>
+</plist>
+`
+}
+
+func TestReadEmlx(t *testing.T) {
+	message := "Return-Path: <bubbles@bubbletown.com>\nFrom: bubbles@bubbletown.com\nSubject: Hi\n\nHello.\n"
+	msg, err := ReadEmlx(strings.NewReader(emlxFile(message, 1656944625, 1|1<<4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.From != "From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022" {
+		t.Errorf("unexpected From line: %q", msg.From)
+	}
+	if !msg.Received.Equal(time.Unix(1656944625, 0)) {
+		t.Errorf("unexpected received time: %v", msg.Received)
+	}
+	if msg.Flags != FlagRead|FlagOld|FlagFlagged {
+		t.Errorf("unexpected flags: %v", msg.Flags)
+	}
+	if msg.Properties["remote-id"] != "4242" || msg.Properties["conversation-id"] != "77" || msg.Properties["partial"] != "false" {
+		t.Errorf("unexpected properties: %v", msg.Properties)
+	}
+	if _, ok := msg.Properties["to"]; ok {
+		t.Error("expected arrays to be skipped")
+	}
+	raw, _ := io.ReadAll(msg.Reader())
+	expected := "Return-Path: <bubbles@bubbletown.com>\nFrom: bubbles@bubbletown.com\nSubject: Hi\nStatus: RO\nX-Status: F\n\nHello.\n"
+	if string(raw) != expected {
+		t.Errorf("expected:\n%q\nbut got:\n%q", expected, raw)
+	}
+
+	_, err = ReadEmlx(strings.NewReader("500\nSubject: Short\n\n"))
+	if err == nil {
+		t.Error("expected an error for a message shorter than its length")
+	}
+	_, err = ReadEmlx(strings.NewReader("lots\nSubject: Short\n\n"))
+	if err == nil {
+		t.Error("expected an error for an invalid length")
+	}
+}
+
+func TestImportEmlx(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"Data/1/Messages/12.emlx":        emlxFile("From: mrspam@corporate.corp.com\nSubject: Second\n\nBuy now.\n", 1656946935, 0),
+		"Data/Messages/3.partial.emlx":   emlxFile("From: bubbles@bubbletown.com\nSubject: First\n\nHello.\n", 1656944625, 1),
+		"Data/Messages/notes.plist":      "ignore me",
+		"Data/2/Messages/20.emlx.backup": "ignore me too",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := bytes.NewBuffer([]byte{})
+	count, err := ImportEmlx(root, NewWriter(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 messages but got %d", count)
+	}
+	expected := "From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022\nFrom: bubbles@bubbletown.com\nSubject: First\nStatus: RO\n\nHello.\n\n" +
+		"From mrspam@corporate.corp.com Mon Jul  4 15:02:15 2022\nFrom: mrspam@corporate.corp.com\nSubject: Second\n\nBuy now.\n\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestAppleMailbox(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "Lazytown.mbox")
+	err := os.MkdirAll(bundle, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(bundle, "mbox"), []byte(maildirMbox), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(bundle, "table_of_contents"), []byte{0, 1, 2}, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := OpenAppleMailbox(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer box.Close()
+	mType, err := DetectType(box.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := box.Reader(mType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for reader.Next() {
+		count++
+	}
+	if reader.Err() != nil {
+		t.Fatal(reader.Err())
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+
+	_, err = OpenAppleMailbox(t.TempDir())
+	if err == nil {
+		t.Error("expected an error opening a bundle without an mbox")
+	}
+}
@@ -0,0 +1,408 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	babylOptions   = "BABYL OPTIONS:" // Opens the header of every Babyl file.
+	babylEOOH      = "*** EOOH ***"   // Separates a message's original header from the one Rmail displays.
+	babylMailFrom  = "Mail-From"      // The header Rmail uses to keep the 'From ' line of a message.
+	babylSeparator = '\x1f'           // Ends each message, and the Babyl file's header.
+)
+
+// errBabylLossless reports Lossless mode set on a reader or writer of Babyl
+// files, which keep labels and attributes outside the message and so can't
+// reproduce them byte for byte.
+var errBabylLossless = fmt.Errorf("babyl files can't be read or written losslessly; use BabylReader and BabylWriter")
+
+// babylFileHeader starts every Babyl file BabylWriter writes.
+const babylFileHeader = babylOptions + " -*- rmail -*-\n" +
+	"Version: 5\n" +
+	"Note:   This is the header of an rmail file.\n" +
+	"Note:   If you are seeing it in rmail,\n" +
+	"Note:    it means the file has no messages in it.\n" +
+	"\x1f"
+
+// babylAttributeFlags maps Babyl's built-in attributes to flags.  Babyl marks
+// new messages 'unseen', rather than marking the others read.
+var babylAttributeFlags = []struct {
+	attribute string
+	flag      Flags
+}{
+	{"answered", FlagAnswered},
+	{"deleted", FlagDeleted},
+}
+
+// BabylMessage describes a single mail read from a Babyl file by
+// BabylReader.Next.
+type BabylMessage struct {
+	Message     *Message    // The message as delivered, with its original headers.
+	Visible     mail.Header // The headers Rmail displays, which match the original ones unless Reformatted.
+	Attributes  []string    // Babyl's built-in attributes, such as 'unseen', 'answered' or 'deleted'.
+	Labels      []string    // The labels the user gave the message.
+	Reformatted bool        // Whether Rmail keeps a reformatted copy of the headers for display.
+}
+
+// BabylReader reads the messages in a Babyl file, as written by Emacs Rmail.
+// Use NewBabylReader to instantiate.  To read a Babyl file as any other mbox,
+// set MboxReader.Type to BABYL instead.
+type BabylReader struct {
+	Options []string // The lines of the file's 'BABYL OPTIONS:' header, filled in by the first call to Next.
+	reader  *MboxReader
+	msg     *BabylMessage
+	err     error
+}
+
+// BabylWriter writes messages to a Babyl file.  Use NewBabylWriter to
+// instantiate.  Setting MboxWriter.Type to BABYL writes through a BabylWriter,
+// recording flags from the 'Status' and 'X-Status' headers as attributes.
+type BabylWriter struct {
+	write   io.Writer
+	started bool
+}
+
+// babylState holds what MboxReader learned about the Babyl message it last
+// read, for BabylReader's benefit.
+type babylState struct {
+	started     bool
+	options     []string
+	attributes  []string
+	labels      []string
+	reformatted bool
+	visible     []byte
+}
+
+// NewBabylReader creates a new BabylReader.
+func NewBabylReader(read io.Reader) *BabylReader {
+	reader := NewReader(read)
+	reader.Type = BABYL
+	return &BabylReader{reader: reader}
+}
+
+// Next advances the BabylReader to the next message, which one may then
+// retrieve with Message.  It returns false when there are no more messages,
+// or when it encountered an error, which Err reports.
+func (r *BabylReader) Next() bool {
+	r.msg = nil
+	if !r.reader.Next() {
+		return false
+	}
+	state := r.reader.babyl
+	r.Options = state.options
+	visible, err := mail.ReadMessage(bytes.NewReader(append(state.visible, '\n')))
+	if err != nil {
+		r.err = err
+		return false
+	}
+	r.msg = &BabylMessage{
+		Message:     r.reader.Message(),
+		Visible:     visible.Header,
+		Attributes:  state.attributes,
+		Labels:      state.labels,
+		Reformatted: state.reformatted,
+	}
+	return true
+}
+
+// Message returns the message found by the most recent call to Next.
+func (r *BabylReader) Message() *BabylMessage {
+	return r.msg
+}
+
+// Err returns the error that stopped Next, if any.  Reaching the end of the
+// file is not an error.
+func (r *BabylReader) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.reader.Err()
+}
+
+// Flags provides the flags recorded in the message's attributes.
+func (msg *BabylMessage) Flags() (result Flags) {
+	result = FlagRead | FlagOld
+	for _, attribute := range msg.Attributes {
+		if attribute == "unseen" {
+			result &^= FlagRead | FlagOld
+		}
+		for _, a := range babylAttributeFlags {
+			if attribute == a.attribute {
+				result |= a.flag
+			}
+		}
+	}
+	return result
+}
+
+// babylAttributes provides the Babyl attributes recording the flags.
+func babylAttributes(f Flags) (result []string) {
+	if f&FlagRead == 0 {
+		result = append(result, "unseen")
+	}
+	for _, a := range babylAttributeFlags {
+		if f&a.flag != 0 {
+			result = append(result, a.attribute)
+		}
+	}
+	return result
+}
+
+// parseBabylAttributes reads the line opening a Babyl message, such as
+// '1, answered, unseen,, work, personal,'.  The leading digit tells whether
+// the headers were reformatted, the built-in attributes follow, and the
+// user's labels follow a doubled comma.
+func parseBabylAttributes(line string) (reformatted bool, attributes []string, labels []string) {
+	line = strings.TrimRight(line, "\r\n")
+	basic, user, _ := strings.Cut(line, ",,")
+	fields := strings.Split(basic, ",")
+	reformatted = strings.TrimSpace(fields[0]) == "1"
+	for _, field := range fields[1:] {
+		if field = strings.TrimSpace(field); len(field) > 0 {
+			attributes = append(attributes, field)
+		}
+	}
+	for _, field := range strings.Split(user, ",") {
+		if field = strings.TrimSpace(field); len(field) > 0 {
+			labels = append(labels, field)
+		}
+	}
+	return reformatted, attributes, labels
+}
+
+// babylAttributeLine provides the line opening a Babyl message that has not
+// been reformatted.
+func babylAttributeLine(attributes []string, labels []string) string {
+	result := "0,"
+	for _, attribute := range attributes {
+		result += " " + attribute + ","
+	}
+	result += ","
+	for _, label := range labels {
+		result += " " + label + ","
+	}
+	return result
+}
+
+// babylLine reads the next line of a Babyl message, reporting the end of the
+// message when it reaches the separator or the end of the file.
+func (m *MboxReader) babylLine() (b []byte, end bool, err error) {
+	peek, err := m.read.Peek(1)
+	if err != nil {
+		return nil, true, err
+	}
+	if peek[0] == babylSeparator {
+		m.read.ReadByte()
+		m.offset++
+		return nil, true, nil
+	}
+	b, err = m.read.ReadBytes('\n')
+	m.offset += int64(len(b))
+	return b, false, err
+}
+
+// nextBabylMessage parses Babyl files.  It writes the message as delivered,
+// with its original headers, taking the 'From ' line from the 'Mail-From'
+// header Rmail keeps, or building one from the headers if it's missing.
+func (m *MboxReader) nextBabylMessage(write io.Writer) (from string, err error) {
+	if m.Lossless {
+		return "", errBabylLossless
+	}
+	if m.babyl == nil {
+		m.babyl = &babylState{}
+	}
+	state := m.babyl
+	m.headerEnd = -1
+	// A form feed on a line of its own opens each message.  Anything before
+	// the first one belongs to the file's header.
+	for {
+		b, err := m.read.ReadBytes('\n')
+		m.offset += int64(len(b))
+		line := bytes.TrimLeft(b, string(babylSeparator))
+		text := string(bytes.TrimRight(line, "\r\n"))
+		if err == nil && text == "\f" {
+			m.start = m.offset - int64(len(line))
+			break
+		}
+		if !state.started && len(text) > 0 {
+			state.options = append(state.options, text)
+		}
+		if err != nil {
+			m.end = m.offset
+			return "", err
+		}
+	}
+	state.started = true
+
+	b, err := m.read.ReadBytes('\n')
+	m.offset += int64(len(b))
+	if err != nil {
+		m.end = m.offset
+		return "", fmt.Errorf("babyl message at offset %d ends before its attributes", m.start)
+	}
+	state.reformatted, state.attributes, state.labels = parseBabylAttributes(string(b))
+
+	original := bytes.NewBuffer([]byte{})
+	for {
+		b, err := m.read.ReadBytes('\n')
+		m.offset += int64(len(b))
+		if string(bytes.TrimRight(b, "\r\n")) == babylEOOH {
+			break
+		}
+		original.Write(b)
+		if err != nil {
+			m.end = m.offset
+			return "", fmt.Errorf("babyl message at offset %d lacks '%s'", m.start, babylEOOH)
+		}
+	}
+
+	visible := bytes.NewBuffer([]byte{})
+	eol := []byte{'\n'}
+	end := false
+	for {
+		b, end, err = m.babylLine()
+		if end || err != nil || isBlankLine(b) {
+			if len(b) > 0 {
+				eol = b
+			}
+			break
+		}
+		visible.Write(b)
+	}
+	state.visible = visible.Bytes()
+
+	header := visible.Bytes()
+	if state.reformatted {
+		header = bytes.TrimRight(original.Bytes(), "\r\n")
+		header = append(header, lineEnding(header)...)
+	}
+	parsed, parseErr := mail.ReadMessage(bytes.NewReader(append(header, '\n')))
+	if parseErr == nil && strings.HasPrefix(parsed.Header.Get(babylMailFrom), "From ") {
+		from = parsed.Header.Get(babylMailFrom)
+		header = rewriteHeader(header, dropHeaders(babylMailFrom), nil)
+	} else if parseErr == nil {
+		date, _ := parsed.Header.Date()
+		from = senderFrom(parsed.Header, date)
+	} else {
+		from = senderFrom(mail.Header{}, time.Time{})
+	}
+	write.Write(header)
+	if !end && err == nil {
+		m.headerEnd = m.offset
+		write.Write(eol)
+		for {
+			b, end, err = m.babylLine()
+			write.Write(b)
+			if end || err != nil {
+				break
+			}
+		}
+	}
+	m.end = m.offset
+	if err == io.EOF {
+		// The file ended without the separator closing the message.
+		if problem := m.problem(ErrTruncatedMessage, m.offset); problem != nil {
+			return from, problem
+		}
+	}
+	if err != nil {
+		return from, err
+	}
+
+	// Skip the line endings following the separator, so we can report the
+	// last message along with io.EOF, as the other types do.
+	for {
+		peek, err := m.read.Peek(1)
+		if err != nil {
+			return from, err
+		}
+		if peek[0] != '\n' && peek[0] != '\r' {
+			return from, nil
+		}
+		m.read.ReadByte()
+		m.offset++
+	}
+}
+
+// NewBabylWriter instantiates a new Babyl file writer.  It writes the Babyl
+// file header along with the first message.
+func NewBabylWriter(write io.Writer) *BabylWriter {
+	return &BabylWriter{write: write}
+}
+
+// WriteMail adds new mail to the Babyl file, along with its built-in
+// attributes (such as 'unseen' or 'answered') and the user's labels.  If from
+// isn't empty, it goes in a 'Mail-From' header, as Rmail keeps it.  Babyl has
+// no way to escape a line starting with ^_, so it refuses mail holding one.
+func (w *BabylWriter) WriteMail(from string, mail io.Reader, attributes []string, labels []string) (err error) {
+	if !w.started {
+		_, err = w.write.Write([]byte(babylFileHeader))
+		if err != nil {
+			return err
+		}
+		w.started = true
+	}
+	_, err = w.write.Write([]byte(fmt.Sprintf("\f\n%s\n%s\n", babylAttributeLine(attributes, labels), babylEOOH)))
+	if err != nil {
+		return err
+	}
+	if len(from) > 0 {
+		from = strings.TrimPrefix(from, "From ")
+		_, err = w.write.Write([]byte(fmt.Sprintf("%s: From %s\n", babylMailFrom, from)))
+		if err != nil {
+			return err
+		}
+	}
+	reader := bufio.NewReader(mail)
+	last := byte('\n')
+	for {
+		b, readErr := reader.ReadBytes('\n')
+		if len(b) > 0 && b[0] == babylSeparator {
+			return fmt.Errorf("babyl can't hold a line starting with ^_")
+		}
+		if len(b) > 0 {
+			_, err = w.write.Write(b)
+			if err != nil {
+				return err
+			}
+			last = b[len(b)-1]
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if last != '\n' {
+		_, err = w.write.Write([]byte{'\n'})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.write.Write([]byte{babylSeparator})
+	return err
+}
+
+// writeBabylMail writes the email to a Babyl file, recording its flags as
+// attributes.
+func (m *MboxWriter) writeBabylMail(from string, content io.Reader) (err error) {
+	if m.babyl == nil {
+		m.babyl = NewBabylWriter(m.write)
+	}
+	raw, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	f := Flags(0)
+	if parsed, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		f = ParseFlags(parsed.Header)
+	}
+	return m.babyl.WriteMail(from, bytes.NewReader(raw), babylAttributes(f), nil)
+}
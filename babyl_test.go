@@ -0,0 +1,203 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var babylBox string = "BABYL OPTIONS: -*- rmail -*-\n" +
+	"Version: 5\n" +
+	"Labels: work\n" +
+	"Note:   This is the header of an rmail file.\n" +
+	"\x1f\f\n" +
+	"1, answered,, work, fun,\n" +
+	"Mail-From: From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022\n" +
+	"Received: from bubbletown.com by lazytown.com\n" +
+	"From: bubbles@bubbletown.com\n" +
+	"To: mrmxpdstk@lazytown.com\n" +
+	"Subject: To interpretation\n" +
+	"\n" +
+	"*** EOOH ***\n" +
+	"From: bubbles@bubbletown.com\n" +
+	"Subject: To interpretation\n" +
+	"\n" +
+	"From all of us, to all of you, be happy!\n" +
+	"\x1f\f\n" +
+	"0, unseen,,\n" +
+	"*** EOOH ***\n" +
+	"Return-Path: <mrspam@corporate.corp.com>\n" +
+	"From: mrspam@corporate.corp.com\n" +
+	"Date: Mon, 04 Jul 2022 15:02:15 +0000\n" +
+	"Subject: Bestest offer in the universe!!11!!\n" +
+	"\n" +
+	"You won't believe these prices!\n" +
+	"\x1f"
+
+func TestBabylReader(t *testing.T) {
+	reader := NewBabylReader(strings.NewReader(babylBox))
+	messages := []*BabylMessage{}
+	for reader.Next() {
+		messages = append(messages, reader.Message())
+	}
+	if reader.Err() != nil {
+		t.Fatal(reader.Err())
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages but got %d", len(messages))
+	}
+	if len(reader.Options) != 4 || reader.Options[2] != "Labels: work" {
+		t.Errorf("unexpected options: %q", reader.Options)
+	}
+
+	first := messages[0]
+	if !first.Reformatted {
+		t.Error("expected the first message to be reformatted")
+	}
+	if !reflect.DeepEqual(first.Attributes, []string{"answered"}) {
+		t.Errorf("unexpected attributes: %q", first.Attributes)
+	}
+	if !reflect.DeepEqual(first.Labels, []string{"work", "fun"}) {
+		t.Errorf("unexpected labels: %q", first.Labels)
+	}
+	if first.Message.From != "From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022" {
+		t.Errorf("unexpected From line: %q", first.Message.From)
+	}
+	if first.Message.Header.Get("Received") != "from bubbletown.com by lazytown.com" {
+		t.Errorf("expected the original headers but got %v", first.Message.Header)
+	}
+	if first.Message.Header.Get("Mail-From") != "" {
+		t.Error("expected the Mail-From header to be removed")
+	}
+	if first.Visible.Get("Received") != "" || first.Visible.Get("Subject") != "To interpretation" {
+		t.Errorf("unexpected visible headers: %v", first.Visible)
+	}
+	body, _ := io.ReadAll(first.Message.Body)
+	if string(body) != "From all of us, to all of you, be happy!\n" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if first.Flags() != FlagRead|FlagOld|FlagAnswered {
+		t.Errorf("unexpected flags: %v", first.Flags())
+	}
+
+	second := messages[1]
+	if second.Reformatted || len(second.Labels) != 0 {
+		t.Errorf("unexpected reformatted %v or labels %q", second.Reformatted, second.Labels)
+	}
+	if second.Message.From != "From mrspam@corporate.corp.com Mon Jul  4 15:02:15 2022" {
+		t.Errorf("expected a From line built from the headers but got %q", second.Message.From)
+	}
+	if second.Visible.Get("Subject") != second.Message.Header.Get("Subject") {
+		t.Error("expected the visible headers to match the original ones")
+	}
+	if !second.Flags().New() {
+		t.Errorf("expected an unseen message to be new: %v", second.Flags())
+	}
+	if second.Message.Offset+second.Message.Length != int64(len(babylBox)) {
+		t.Errorf("expected the message to end at %d but got %d", len(babylBox), second.Message.Offset+second.Message.Length)
+	}
+}
+
+func TestBabylIndex(t *testing.T) {
+	idx, err := BuildIndex(strings.NewReader(babylBox), BABYL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 2 {
+		t.Fatalf("expected 2 entries but got %d", idx.Len())
+	}
+	msg, err := NewRandomReader(strings.NewReader(babylBox), idx).Message(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Received") == "" {
+		t.Errorf("expected the original headers but got %v", msg.Header)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if string(body) != "From all of us, to all of you, be happy!\n" {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestBabylWriter(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	writer := NewBabylWriter(buf)
+	err := writer.WriteMail("From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022", strings.NewReader("From: bubbles@bubbletown.com\nSubject: Hi\n\nHello"), []string{"unseen"}, []string{"work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := babylFileHeader + "\f\n0, unseen,, work,\n*** EOOH ***\n" +
+		"Mail-From: From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022\n" +
+		"From: bubbles@bubbletown.com\nSubject: Hi\n\nHello\n\x1f"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\nbut got:\n%q", expected, buf.String())
+	}
+	err = writer.WriteMail("", strings.NewReader("Subject: Trouble\n\n\x1fOops\n"), nil, nil)
+	if err == nil {
+		t.Error("expected an error writing a line starting with ^_")
+	}
+}
+
+func TestBabylRoundTrip(t *testing.T) {
+	// Convert the mbox to Babyl, then back to mboxrd, recording the flags as
+	// Babyl attributes along the way.
+	babyl := bytes.NewBuffer([]byte{})
+	_, err := Convert(babyl, BABYL, strings.NewReader(maildirMbox), MBOXRD, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mType, err := DetectType(bytes.NewReader(babyl.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mType != BABYL {
+		t.Errorf("expected %d but got %d", BABYL, mType)
+	}
+	reader := NewBabylReader(bytes.NewReader(babyl.Bytes()))
+	attributes := [][]string{}
+	for reader.Next() {
+		attributes = append(attributes, reader.Message().Attributes)
+	}
+	expected := [][]string{nil, {"unseen"}, {"unseen", "answered", "deleted"}}
+	if !reflect.DeepEqual(attributes, expected) {
+		t.Errorf("expected attributes %q but got %q", expected, attributes)
+	}
+
+	mboxrd := bytes.NewBuffer([]byte{})
+	_, err = Convert(mboxrd, MBOXRD, bytes.NewReader(babyl.Bytes()), BABYL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct := bytes.NewBuffer([]byte{})
+	_, err = Convert(direct, MBOXRD, strings.NewReader(maildirMbox), MBOXRD, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mboxrd.String() != direct.String() {
+		t.Errorf("expected:\n%s\nbut got:\n%s", direct.String(), mboxrd.String())
+	}
+}
+
+func TestBabylLossless(t *testing.T) {
+	reader := NewReader(strings.NewReader(babylBox))
+	reader.Type = BABYL
+	reader.Lossless = true
+	_, err := reader.NextMessage(io.Discard)
+	if err != errBabylLossless {
+		t.Errorf("expected %v reading but got %v", errBabylLossless, err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	writer := NewWriter(buf)
+	writer.Type = BABYL
+	writer.Lossless = true
+	err = writer.WriteMail("From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022", strings.NewReader("Subject: Hi\n\nHello\n"))
+	if err != errBabylLossless {
+		t.Errorf("expected %v writing but got %v", errBabylLossless, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written but got %q", buf.String())
+	}
+}
@@ -0,0 +1,185 @@
+package mbox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion identifies the layout of the index cache file.  Change it
+// whenever indexCache changes so old caches get rebuilt instead of misread.
+const cacheVersion = 1
+
+// cacheSampleSize describes how many bytes at the start and end of an mbox
+// get hashed to notice when the mbox changed underneath its cache.
+const cacheSampleSize = 4096
+
+// indexCache describes the contents of an index cache file.
+type indexCache struct {
+	Version int    // The cacheVersion that wrote the cache.
+	Size    int64  // The size of the mbox when indexed.
+	ModTime int64  // The modification time of the mbox when indexed, in Unix nanoseconds.
+	Head    []byte // A hash of the first bytes of the mbox.
+	Tail    []byte // A hash of the last bytes of the mbox.
+	Index   Index  // The index itself.
+}
+
+// CachedIndex provides an Index for the mbox at path, keeping it in a sidecar
+// file at cachePath so later calls need not read the whole mbox again.  If
+// cachePath is empty, it uses path with ".idx" appended.
+//
+// The cache remembers the size, modification time and a hash of the first and
+// last bytes of the mbox.  If the mbox merely grew since the cache was
+// written, it reads only the new messages (and the last known one, which may
+// have grown).  If anything else about the mbox changed, it rebuilds the index
+// from scratch.  The Type of the index must match mboxType, or it rebuilds
+// the index.
+//
+// The cache is only an optimisation, so failing to write it isn't an error:
+// CachedIndex still returns the index, and the next call builds it again.
+func CachedIndex(path string, cachePath string, mboxType int) (result *Index, err error) {
+	if len(cachePath) == 0 {
+		cachePath = path + ".idx"
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	cache, err := loadIndexCache(cachePath)
+	if err == nil && cache.Version == cacheVersion && cache.Index.Type == mboxType {
+		result, err = cache.update(file, size, info.ModTime().UnixNano())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result == nil {
+		result, err = BuildIndex(io.NewSectionReader(file, 0, size), mboxType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cache = &indexCache{
+		Version: cacheVersion,
+		Size:    size,
+		ModTime: info.ModTime().UnixNano(),
+		Index:   *result,
+	}
+	cache.Head, cache.Tail, err = sampleHashes(file, size)
+	if err == nil {
+		cache.save(cachePath)
+	}
+	return result, nil
+}
+
+// update brings the cached index up to date with the mbox in file, returning
+// nil if the cache can't be trusted and the index needs rebuilding.
+func (c *indexCache) update(file io.ReaderAt, size int64, modTime int64) (result *Index, err error) {
+	if size < c.Size {
+		// Something removed data from the mbox.
+		return nil, nil
+	}
+	head, tail, err := sampleHashes(file, c.Size)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head, c.Head) || !bytes.Equal(tail, c.Tail) {
+		// The part of the mbox we indexed has changed.
+		return nil, nil
+	}
+	result = &Index{Type: c.Index.Type, Entries: c.Index.Entries}
+	if size == c.Size {
+		if modTime == c.ModTime {
+			return result, nil
+		}
+		// Something rewrote the mbox without changing its size.  We can't
+		// tell what moved, so we start over.
+		return nil, nil
+	}
+	// The mbox has been appended to.  The last message we knew about may have
+	// grown, so we start again from there.
+	start := int64(0)
+	if len(result.Entries) > 0 {
+		start = result.Entries[len(result.Entries)-1].From
+		result.Entries = result.Entries[:len(result.Entries)-1]
+	}
+	entries, err := scanIndex(io.NewSectionReader(file, start, size-start), start, result.Type)
+	if err != nil {
+		return nil, err
+	}
+	result.Entries = append(result.Entries, entries...)
+	return result, nil
+}
+
+// sampleHashes hashes the first and last cacheSampleSize bytes of the first
+// size bytes of file.
+func sampleHashes(file io.ReaderAt, size int64) (head []byte, tail []byte, err error) {
+	sample := int64(cacheSampleSize)
+	if sample > size {
+		sample = size
+	}
+	head, err = hashSection(io.NewSectionReader(file, 0, sample))
+	if err != nil {
+		return nil, nil, err
+	}
+	tail, err = hashSection(io.NewSectionReader(file, size-sample, sample))
+	if err != nil {
+		return nil, nil, err
+	}
+	return head, tail, nil
+}
+
+func hashSection(section *io.SectionReader) (result []byte, err error) {
+	hash := sha256.New()
+	_, err = io.Copy(hash, section)
+	if err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// loadIndexCache reads an index cache file.
+func loadIndexCache(cachePath string) (result *indexCache, err error) {
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	result = &indexCache{}
+	err = gob.NewDecoder(file).Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read index cache: %s", err)
+	}
+	return result, nil
+}
+
+// save writes the index cache file, replacing any existing one only once the
+// new one has been written completely.
+func (c *indexCache) save(cachePath string) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), filepath.Base(cachePath)+"_*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = gob.NewEncoder(tmp).Encode(c)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
+}
@@ -0,0 +1,189 @@
+package mbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var appendedMboxo string = `From another
+From: nobody@nowhere.man
+To: mrmxpdstk@lazytown.com
+Subject: Late to the party
+
+Sorry I'm late.
+`
+
+func TestCachedIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := CachedIndex(path, "", MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 2 {
+		t.Fatalf("expected 2 entries but got %d", idx.Len())
+	}
+	_, err = os.Stat(path + ".idx")
+	if err != nil {
+		t.Fatalf("expected a cache file: %s", err)
+	}
+
+	// Reading again without changes must give the same index.
+	again, err := CachedIndex(path, "", MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Len() != 2 || again.Entries[1] != idx.Entries[1] {
+		t.Errorf("expected %+v but got %+v", idx.Entries, again.Entries)
+	}
+
+	// Asking for a different type must rebuild rather than trust the cache.
+	other, err := CachedIndex(path, "", MBOXRD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Type != MBOXRD {
+		t.Errorf("expected type %d but got %d", MBOXRD, other.Type)
+	}
+}
+
+func TestCachedIndexAppend(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	cachePath := filepath.Join(dir, "mbox.cache")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := CachedIndex(path, cachePath, MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mark the first entry so we can tell whether the cache was extended or
+	// rebuilt.
+	cache, err := loadIndexCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Index.Entries[0].HeaderEnd = 1
+	err = cache.save(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString(appendedMboxo)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extended, err := CachedIndex(path, cachePath, MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extended.Len() != 3 {
+		t.Fatalf("expected 3 entries but got %d", extended.Len())
+	}
+	if extended.Entries[0].HeaderEnd != 1 {
+		t.Errorf("expected the cache to be extended rather than rebuilt")
+	}
+	if extended.Entries[1].From != idx.Entries[1].From {
+		t.Errorf("expected %d but got %d", idx.Entries[1].From, extended.Entries[1].From)
+	}
+	if extended.Entries[2].BodyEnd != int64(len(mboxo)+len(appendedMboxo)) {
+		t.Errorf("expected the last entry to end at %d but got %d", len(mboxo)+len(appendedMboxo), extended.Entries[2].BodyEnd)
+	}
+}
+
+func TestCachedIndexInvalidated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	cachePath := filepath.Join(dir, "mbox.cache")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CachedIndex(path, cachePath, MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := loadIndexCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Index.Entries[0].HeaderEnd = 1
+	err = cache.save(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Change the prefix, but append as well, so it looks like it grew.
+	changed := []byte(mboxo + appendedMboxo)
+	changed[len("From someone\nFrom: ")] = 'B'
+	err = os.WriteFile(path, changed, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+
+	idx, err := CachedIndex(path, cachePath, MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 3 {
+		t.Fatalf("expected 3 entries but got %d", idx.Len())
+	}
+	if idx.Entries[0].HeaderEnd == 1 {
+		t.Errorf("expected the cache to be rebuilt")
+	}
+
+	// A corrupt cache must be rebuilt, too.
+	err = os.WriteFile(cachePath, []byte("moo"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err = CachedIndex(path, cachePath, MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 3 {
+		t.Errorf("expected 3 entries but got %d", idx.Len())
+	}
+
+	_, err = CachedIndex(filepath.Join(dir, "missing"), "", MBOXO)
+	if err == nil {
+		t.Errorf("expected an error for a missing mbox")
+	}
+}
+
+func TestCachedIndexUnwritable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache can't be written inside a directory that doesn't exist.
+	cachePath := filepath.Join(dir, "missing", "mbox.idx")
+	idx, err := CachedIndex(path, cachePath, MBOXO)
+	if err != nil {
+		t.Fatalf("expected no error but got %s", err)
+	}
+	if idx.Len() != 2 {
+		t.Errorf("expected 2 entries but got %d", idx.Len())
+	}
+}
@@ -0,0 +1,248 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	dsnetbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// detectSampleSize limits how much of a stream DetectReader looks at to work
+// out the type of mbox it holds.
+const detectSampleSize = 1 << 20
+
+// Compression describes a compressed file format holding an mbox.  Register
+// your own with RegisterCompression, for formats not built in, or to replace
+// the implementation of one that is.
+type Compression struct {
+	Name      string                                        // A name for the format, such as 'gzip'.
+	Magic     []byte                                        // The bytes starting every file in the format.
+	Extension string                                        // The file name extension for the format, such as '.gz'.
+	NewReader func(read io.Reader) (io.ReadCloser, error)   // Decompresses a stream, or nil if unsupported.
+	NewWriter func(write io.Writer) (io.WriteCloser, error) // Compresses a stream, or nil if unsupported.
+}
+
+// CompressedReader reads an mbox file that may be compressed.  Use Open to
+// instantiate, and Close when done.
+type CompressedReader struct {
+	*MboxReader
+	Compression string // The name of the compression found, or empty if the file isn't compressed.
+	file        *os.File
+	stream      io.ReadCloser
+}
+
+// CompressedWriter writes an mbox file that may be compressed.  Use Create to
+// instantiate, and Close when done, which finishes the compressed stream.
+type CompressedWriter struct {
+	*MboxWriter
+	Compression string // The name of the compression used, or empty if the file isn't compressed.
+	file        *os.File
+	stream      io.WriteCloser
+}
+
+// compressionsLock protects compressions.
+var compressionsLock sync.RWMutex
+
+// compressions holds the known compressed formats.  The standard library
+// handles gzip, and reads bzip2; other packages fill in the rest.
+var compressions = []Compression{
+	{
+		Name:      "gzip",
+		Magic:     []byte{0x1f, 0x8b},
+		Extension: ".gz",
+		NewReader: func(read io.Reader) (io.ReadCloser, error) { return gzip.NewReader(read) },
+		NewWriter: func(write io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(write), nil },
+	},
+	{
+		Name:      "bzip2",
+		Magic:     []byte("BZh"),
+		Extension: ".bz2",
+		NewReader: func(read io.Reader) (io.ReadCloser, error) { return io.NopCloser(bzip2.NewReader(read)), nil },
+		NewWriter: func(write io.Writer) (io.WriteCloser, error) { return dsnetbzip2.NewWriter(write, nil) },
+	},
+	{
+		Name:      "xz",
+		Magic:     []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		Extension: ".xz",
+		NewReader: func(read io.Reader) (io.ReadCloser, error) {
+			stream, err := xz.NewReader(read)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(stream), nil
+		},
+		NewWriter: func(write io.Writer) (io.WriteCloser, error) { return xz.NewWriter(write) },
+	},
+	{
+		Name:      "zstd",
+		Magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+		Extension: ".zst",
+		NewReader: func(read io.Reader) (io.ReadCloser, error) {
+			stream, err := zstd.NewReader(read)
+			if err != nil {
+				return nil, err
+			}
+			return stream.IOReadCloser(), nil
+		},
+		NewWriter: func(write io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(write) },
+	},
+}
+
+// RegisterCompression adds a compressed format, or replaces the one with the
+// same name.  Use it to support other formats, or to handle a built-in one
+// with a package of your choosing.
+func RegisterCompression(c Compression) {
+	compressionsLock.Lock()
+	defer compressionsLock.Unlock()
+	for i := range compressions {
+		if compressions[i].Name == c.Name {
+			compressions[i] = c
+			return
+		}
+	}
+	compressions = append(compressions, c)
+}
+
+// findCompression provides the first compressed format for which match
+// returns true, or nil if none do.
+func findCompression(match func(c *Compression) bool) *Compression {
+	compressionsLock.RLock()
+	defer compressionsLock.RUnlock()
+	for i := range compressions {
+		if match(&compressions[i]) {
+			c := compressions[i]
+			return &c
+		}
+	}
+	return nil
+}
+
+// decompress works out whether read holds a compressed format from its magic
+// bytes, providing the decompressed stream.  It provides a nil Compression
+// and the stream as-is when it finds no compression.
+func decompress(read io.Reader) (c *Compression, stream io.ReadCloser, err error) {
+	buffered := bufio.NewReader(read)
+	// A short peek just means a short file, which we'll treat as uncompressed.
+	head, _ := buffered.Peek(16)
+	c = findCompression(func(c *Compression) bool {
+		return len(c.Magic) > 0 && bytes.HasPrefix(head, c.Magic)
+	})
+	if c == nil {
+		return nil, io.NopCloser(buffered), nil
+	}
+	if c.NewReader == nil {
+		return c, nil, fmt.Errorf("no %s decompressor available; provide one with RegisterCompression", c.Name)
+	}
+	stream, err = c.NewReader(buffered)
+	if err != nil {
+		return c, nil, err
+	}
+	return c, stream, nil
+}
+
+// DetectCompressedType works out whether read holds a compressed mbox, and
+// the type of the mbox within, from the first part of the decompressed
+// stream, as DetectReader does.  It returns the name of the compression, or
+// an empty string if read isn't compressed.  It consumes some or all of read.
+func DetectCompressedType(read io.Reader) (mboxType int, compression string, err error) {
+	c, stream, err := decompress(read)
+	if c != nil {
+		compression = c.Name
+	}
+	if err != nil {
+		return -1, compression, err
+	}
+	defer stream.Close()
+	mboxType, _, err = DetectReader(stream)
+	return mboxType, compression, err
+}
+
+// Open opens the mbox file at path for reading, decompressing it if its
+// magic bytes show it's compressed.  It sets the reader's Type from the first
+// part of the mbox, as DetectReader would; change it before reading if you
+// know better.
+func Open(path string) (result *CompressedReader, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c, stream, err := decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	mboxType, replay, err := DetectReader(stream)
+	if err != nil {
+		stream.Close()
+		file.Close()
+		return nil, err
+	}
+	result = &CompressedReader{MboxReader: NewReader(replay), file: file, stream: stream}
+	result.Type = mboxType
+	if c != nil {
+		result.Compression = c.Name
+	}
+	return result, nil
+}
+
+// Close closes the mbox file.
+func (r *CompressedReader) Close() error {
+	err := r.stream.Close()
+	closeErr := r.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Create creates the mbox file at path, replacing any file already there, and
+// provides a writer of the given type for it.  It compresses the mbox when
+// the file name ends with the extension of a known compressed format, such
+// as '.gz'.
+func Create(path string, mboxType int) (result *CompressedWriter, err error) {
+	c := findCompression(func(c *Compression) bool {
+		return len(c.Extension) > 0 && strings.HasSuffix(path, c.Extension)
+	})
+	if c != nil && c.NewWriter == nil {
+		return nil, fmt.Errorf("no %s compressor available; provide one with RegisterCompression", c.Name)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	result = &CompressedWriter{file: file}
+	var write io.Writer = file
+	if c != nil {
+		result.Compression = c.Name
+		result.stream, err = c.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		write = result.stream
+	}
+	result.MboxWriter = NewWriter(write)
+	result.Type = mboxType
+	return result, nil
+}
+
+// Close finishes any compressed stream, then closes the mbox file.
+func (w *CompressedWriter) Close() (err error) {
+	if w.stream != nil {
+		err = w.stream.Close()
+	}
+	closeErr := w.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package mbox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bzip2Mbox holds a one message mboxrd, compressed with bzip2.
+const bzip2Mbox = "QlpoOTFBWSZTWUs7ErQAABffgAAQYAV+EUkSCAA/V96gIABqIo9CNMaTRoA9QGmg0KNNDRoAGgaaaMkCCzNxLfxtXySk2ApJhP6THuppi5CBwh8Q5RavNACDMeNCG8I52YvVBjdInsGLqlCCAURfHisRoJj/bTW22YSourYQkIvgE5qSwfxdyRThQkEs7ErQ"
+
+func TestCreateOpenGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "box.mbox.gz")
+	writer, err := Create(path, MBOXRD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writer.Compression != "gzip" {
+		t.Errorf("expected gzip but got %q", writer.Compression)
+	}
+	err = writer.WriteMail("From someone Mon Jul  4 14:23:45 2022", strings.NewReader(email4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		t.Fatal("expected a gzip file")
+	}
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Compression != "gzip" || reader.Type != MBOXRD {
+		t.Errorf("expected gzip and %d but got %q and %d", MBOXRD, reader.Compression, reader.Type)
+	}
+	if !reader.Next() {
+		t.Fatalf("expected a message: %v", reader.Err())
+	}
+	// The blank line separating messages stays with the message.
+	if content, _ := io.ReadAll(reader.Message().Reader()); string(content) != email4+"\n" {
+		t.Errorf("expected:\n%s\nbut got:\n%s", email4, content)
+	}
+	if reader.Next() {
+		t.Error("expected a single message")
+	}
+}
+
+func TestOpenPlain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "box.mbox")
+	err := os.WriteFile(path, []byte(mboxcl), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Compression != "" || reader.Type != MBOXCL {
+		t.Errorf("expected no compression and %d but got %q and %d", MBOXCL, reader.Compression, reader.Type)
+	}
+	count := 0
+	for reader.Next() {
+		count++
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+}
+
+func TestDetectCompressedType(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(bzip2Mbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hide the Seek method, to be sure we don't need it.
+	mType, compression, err := DetectCompressedType(io.MultiReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compression != "bzip2" || mType != MBOXRD {
+		t.Errorf("expected bzip2 and %d but got %q and %d", MBOXRD, compression, mType)
+	}
+}
+
+func TestCreateOpenCompressions(t *testing.T) {
+	formats := map[string]string{
+		".bz2": "bzip2",
+		".xz":  "xz",
+		".zst": "zstd",
+	}
+	for extension, name := range formats {
+		path := filepath.Join(t.TempDir(), "box.mbox"+extension)
+		writer, err := Create(path, MBOXRD)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		err = writer.WriteMail("From someone Mon Jul  4 14:23:45 2022", strings.NewReader(email4))
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mType, compression, err := DetectCompressedType(file)
+		file.Close()
+		if err != nil || compression != name || mType != MBOXRD {
+			t.Errorf("expected %s and %d but got %q and %d: %v", name, MBOXRD, compression, mType, err)
+		}
+
+		reader, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reader.Next() {
+			t.Fatalf("%s: expected a message: %v", name, reader.Err())
+		}
+		if content, _ := io.ReadAll(reader.Message().Reader()); string(content) != email4+"\n" {
+			t.Errorf("%s: expected:\n%s\nbut got:\n%s", name, email4, content)
+		}
+		err = reader.Close()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestRegisterCompression(t *testing.T) {
+	compressionsLock.Lock()
+	saved := append([]Compression{}, compressions...)
+	compressionsLock.Unlock()
+	defer func() {
+		compressionsLock.Lock()
+		compressions = saved
+		compressionsLock.Unlock()
+	}()
+
+	// Pretend gzip is zstd.
+	RegisterCompression(Compression{
+		Name:      "zstd",
+		Magic:     []byte{0x1f, 0x8b},
+		Extension: ".zst",
+		NewReader: func(read io.Reader) (io.ReadCloser, error) { return gzip.NewReader(read) },
+		NewWriter: func(write io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(write), nil },
+	})
+	path := filepath.Join(t.TempDir(), "box.mbox.zst")
+	writer, err := Create(path, MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writer.Compression != "zstd" {
+		t.Errorf("expected zstd but got %q", writer.Compression)
+	}
+	err = writer.WriteMail("From someone", strings.NewReader(email3))
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	// The gzip entry comes first, so it wins the magic bytes.
+	if reader.Compression != "gzip" {
+		t.Errorf("expected gzip but got %q", reader.Compression)
+	}
+	if !reader.Next() || reader.Message().Header.Get("Subject") != "Mysterious Jenkins" {
+		t.Errorf("expected to read the message back: %v", reader.Err())
+	}
+}
@@ -0,0 +1,306 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentLengthProblem describes a message in an MBOXCL or MBOXCL2 mbox whose
+// 'Content-Length' header doesn't bring its body to an end just before the
+// next 'From ' line, or the end of the mbox.
+type ContentLengthProblem struct {
+	Index    int   // The position of the message within the mbox.
+	Offset   int64 // The offset of the message's 'From ' line.
+	Declared int64 // The length given by the 'Content-Length' header, or -1 if it is missing or unreadable.
+	Actual   int64 // The length of the body, running to the nearest plausible boundary.
+}
+
+// String describes the problem.
+func (p ContentLengthProblem) String() string {
+	if p.Declared < 0 {
+		return fmt.Sprintf("message %d at offset %d: missing Content-Length, body is %d bytes", p.Index, p.Offset, p.Actual)
+	}
+	return fmt.Sprintf("message %d at offset %d: Content-Length %d should be %d", p.Index, p.Offset, p.Declared, p.Actual)
+}
+
+// lengthEntry records where a message lives within an mbox, as worked out by
+// scanContentLength.
+type lengthEntry struct {
+	from      int64 // The offset of the 'From ' line.
+	headerAt  int64 // The offset just past the 'From ' line, where the header begins.
+	bodyStart int64 // The offset just past the blank line ending the header.
+	end       int64 // The offset just past the body.
+	declared  int64 // The length from 'Content-Length', or -1.
+}
+
+// VerifyContentLength walks the MBOXCL or MBOXCL2 mbox in read, which holds
+// size bytes, reporting each message whose 'Content-Length' header is
+// missing, or doesn't land on the start of a 'From ' line or the end of the
+// mbox.  Where a length is wrong, it works out the body's length from the
+// 'From ' line (or end of the mbox) nearest to where the header said the body
+// would end, then carries on from there.  As mboxcl2 leaves 'From ' lines in
+// bodies alone, it only counts a 'From ' line holding a date, as ParseFrom
+// reads it, as the start of a message.
+func VerifyContentLength(read io.ReaderAt, size int64) (problems []ContentLengthProblem, err error) {
+	_, problems, err = scanContentLength(read, size)
+	return problems, err
+}
+
+// RepairContentLength rewrites the MBOXCL or MBOXCL2 mbox at path, giving
+// each message VerifyContentLength reports a 'Content-Length' header holding
+// the corrected length.  It leaves every other byte alone.  Like Expunge, it
+// writes a temporary file and renames it over the mbox, holding the described
+// locks if lock isn't nil.  It returns the problems it repaired.
+func RepairContentLength(path string, lock *LockOptions) (problems []ContentLengthProblem, err error) {
+	file, closer, err := openMailbox(path, lock)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	entries, problems, err := scanContentLength(file, info.Size())
+	if err != nil || len(problems) == 0 {
+		return problems, err
+	}
+	err = replaceMailbox(path, file, func(dst io.Writer) error {
+		return writeRepairedLengths(dst, file, entries, problems)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+// scanContentLength finds every message in the mbox, checking each one's
+// 'Content-Length' header against the boundaries in the mbox.
+func scanContentLength(read io.ReaderAt, size int64) (entries []lengthEntry, problems []ContentLengthProblem, err error) {
+	bounds, err := findBoundaries(read, size)
+	if err != nil || len(bounds.offsets) == 0 {
+		return nil, nil, err
+	}
+
+	for pos := bounds.offsets[0]; pos < size; {
+		entry, err := readLengthHeader(read, size, pos)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.end, err = bounds.lengthEnd(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry.end < 0 {
+			// Look for the boundary nearest where the length said the body
+			// would end, or the first one, without a length.
+			target := entry.bodyStart
+			if entry.declared > size-entry.bodyStart {
+				target = size
+			} else if entry.declared > 0 {
+				target += entry.declared
+			}
+			entry.end = bounds.nearest(entry.bodyStart, target)
+			problems = append(problems, ContentLengthProblem{
+				Index:    len(entries),
+				Offset:   entry.from,
+				Declared: entry.declared,
+				Actual:   entry.end - entry.bodyStart,
+			})
+		}
+		entries = append(entries, entry)
+		pos = entry.end
+	}
+	return entries, problems, nil
+}
+
+// boundaries describes where messages may start within an mbox: at each
+// 'From ' line holding a date, as ParseFrom reads it, and at the end of the
+// mbox.  As mboxcl2 leaves 'From ' lines in bodies alone, no other 'From '
+// line can be trusted to start a message.
+type boundaries struct {
+	read    io.ReaderAt
+	size    int64
+	offsets []int64 // The offsets of the 'From ' lines holding a date, in order.
+}
+
+// findBoundaries finds the boundaries within the mbox in read, which holds
+// size bytes.
+func findBoundaries(read io.ReaderAt, size int64) (result *boundaries, err error) {
+	offsets, err := fromLineOffsets(read, size, plausibleFrom)
+	if err != nil {
+		return nil, err
+	}
+	return &boundaries{read: read, size: size, offsets: offsets}, nil
+}
+
+// contains determines whether a message may start at offset.
+func (b *boundaries) contains(offset int64) bool {
+	return offset == b.size || b.next(offset) == offset
+}
+
+// next provides the first boundary at or after offset.
+func (b *boundaries) next(offset int64) int64 {
+	i := sort.Search(len(b.offsets), func(i int) bool { return b.offsets[i] >= offset })
+	if i < len(b.offsets) {
+		return b.offsets[i]
+	}
+	return b.size
+}
+
+// nearest provides the boundary, at or after bodyStart, nearest to target.
+// Ties go to the earlier offset.
+func (b *boundaries) nearest(bodyStart int64, target int64) int64 {
+	i := sort.Search(len(b.offsets), func(i int) bool { return b.offsets[i] >= bodyStart })
+	candidates := append(append([]int64{}, b.offsets[i:]...), b.size)
+	best := candidates[0]
+	distance := func(offset int64) int64 {
+		if offset > target {
+			return offset - target
+		}
+		return target - offset
+	}
+	for _, candidate := range candidates[1:] {
+		if distance(candidate) < distance(best) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// lengthEnd provides the offset just past the body of entry, when its
+// 'Content-Length' header brings the body to a boundary.  Writers such as
+// mutt leave a blank line between the body and the next 'From ' line,
+// outside the length, so it skips any blank lines first.  It provides -1 if
+// the length is missing or wrong.
+func (b *boundaries) lengthEnd(entry lengthEntry) (end int64, err error) {
+	if entry.declared < 0 || entry.declared > b.size-entry.bodyStart {
+		return -1, nil
+	}
+	end, err = skipBlankLines(b.read, b.size, entry.bodyStart+entry.declared)
+	if err != nil || !b.contains(end) {
+		return -1, err
+	}
+	return end, nil
+}
+
+// fromLineOffsets provides the offset of every line in the mbox starting with
+// 'From ', in order.  If match isn't nil, it only provides the lines match
+// accepts.
+func fromLineOffsets(read io.ReaderAt, size int64, match func(line string) bool) (result []int64, err error) {
+	reader := bufio.NewReader(io.NewSectionReader(read, 0, size))
+	offset := int64(0)
+	atStart := true
+	for {
+		b, err := reader.ReadSlice('\n')
+		if atStart && bytes.HasPrefix(b, []byte("From ")) && (match == nil || match(string(b))) {
+			result = append(result, offset)
+		}
+		offset += int64(len(b))
+		// A line longer than the buffer arrives in pieces.
+		atStart = err == nil
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+}
+
+// skipBlankLines provides the offset following any blank lines at offset in
+// the mbox in read, which holds size bytes.
+func skipBlankLines(read io.ReaderAt, size int64, offset int64) (result int64, err error) {
+	reader := bufio.NewReader(io.NewSectionReader(read, offset, size-offset))
+	for {
+		b, err := reader.ReadBytes('\n')
+		if len(b) == 0 || !isBlankLine(b) {
+			return offset, nil
+		}
+		offset += int64(len(b))
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+	}
+}
+
+// readLengthHeader reads the header of the message whose 'From ' line starts
+// at offset, finding where its body starts and the length its first
+// 'Content-Length' header gives.
+func readLengthHeader(read io.ReaderAt, size int64, offset int64) (entry lengthEntry, err error) {
+	entry = lengthEntry{from: offset, declared: -1}
+	reader := bufio.NewReader(io.NewSectionReader(read, offset, size-offset))
+	found := false
+	for pos := offset; ; {
+		b, err := reader.ReadBytes('\n')
+		pos += int64(len(b))
+		if entry.headerAt == 0 {
+			entry.headerAt = pos
+		} else if isBlankLine(b) {
+			entry.bodyStart = pos
+			return entry, nil
+		} else if name, value, ok := strings.Cut(string(b), ":"); ok && !found && strings.EqualFold(name, "Content-Length") {
+			found = true
+			if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && n >= 0 {
+				entry.declared = n
+			}
+		}
+		if err == io.EOF {
+			// The header runs to the end of the mbox.
+			entry.bodyStart = pos
+			return entry, nil
+		}
+		if err != nil {
+			return entry, err
+		}
+	}
+}
+
+// writeRepairedLengths copies the mbox in src to dst, replacing the
+// 'Content-Length' header of each message with a problem.
+func writeRepairedLengths(dst io.Writer, src io.ReaderAt, entries []lengthEntry, problems []ContentLengthProblem) (err error) {
+	fixed := map[int]bool{}
+	for _, p := range problems {
+		fixed[p.Index] = true
+	}
+	_, err = io.Copy(dst, io.NewSectionReader(src, 0, entries[0].from))
+	if err != nil {
+		return err
+	}
+	for n, entry := range entries {
+		if !fixed[n] {
+			_, err = io.Copy(dst, io.NewSectionReader(src, entry.from, entry.end-entry.from))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err = io.Copy(dst, io.NewSectionReader(src, entry.from, entry.headerAt-entry.from))
+		if err != nil {
+			return err
+		}
+		header := make([]byte, entry.bodyStart-entry.headerAt)
+		_, err = src.ReadAt(header, entry.headerAt)
+		if err != nil {
+			return err
+		}
+		length := fmt.Sprintf("Content-Length: %d", entry.end-entry.bodyStart)
+		_, err = dst.Write(rewriteHeader(header, dropHeaders("Content-Length"), []string{length}))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, io.NewSectionReader(src, entry.bodyStart, entry.end-entry.bodyStart))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package mbox
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// brokenLengths holds an mboxcl2 whose lengths other tools have mangled.  The
+// first is too short, the second is right despite a 'From ' line in the body,
+// the third is missing and the last runs past the end.
+var brokenLengths string = `From a Mon Jul  4 14:23:45 2022
+Content-Length: 10
+Subject: Too short
+
+This body is longer than ten bytes.
+From b Mon Jul  4 14:23:46 2022
+Subject: Just right
+Content-Length: 23
+
+From me, with love.
+Hi
+From c Mon Jul  4 14:23:47 2022
+Subject: Missing
+
+Nothing to measure.
+From d Mon Jul  4 14:23:48 2022
+Subject: Too long
+Content-Length: 500
+
+The end.
+`
+
+// muttLengths holds an mboxcl2 as mutt writes it, with a blank line after
+// each body that its 'Content-Length' header leaves out.
+var muttLengths string = "From a Mon Jul  4 14:23:45 2022\n" +
+	"Content-Length: 9\n" +
+	"\n" +
+	"One body\n" +
+	"\n" +
+	"From b Mon Jul  4 14:23:46 2022\r\n" +
+	"Content-Length: 10\r\n" +
+	"\r\n" +
+	"Two body\r\n" +
+	"\r\n" +
+	"From c Mon Jul  4 14:23:47 2022\n" +
+	"Content-Length: 10\n" +
+	"\n" +
+	"Last body\n" +
+	"\n"
+
+func TestVerifyContentLength(t *testing.T) {
+	problems, err := VerifyContentLength(strings.NewReader(brokenLengths), int64(len(brokenLengths)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ContentLengthProblem{
+		{Index: 0, Offset: 0, Declared: 10, Actual: 36},
+		{Index: 2, Offset: int64(strings.Index(brokenLengths, "From c")), Declared: -1, Actual: 20},
+		{Index: 3, Offset: int64(strings.Index(brokenLengths, "From d")), Declared: 500, Actual: 9},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected:\n%v\nbut got:\n%v", expected, problems)
+	}
+	if problems[1].String() != "message 2 at offset 202: missing Content-Length, body is 20 bytes" {
+		t.Errorf("unexpected description: %s", problems[1])
+	}
+
+	problems, err = VerifyContentLength(strings.NewReader(mboxcl), int64(len(mboxcl)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems but got %v", problems)
+	}
+}
+
+func TestVerifyContentLengthMutt(t *testing.T) {
+	problems, err := VerifyContentLength(strings.NewReader(muttLengths), int64(len(muttLengths)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems but got %v", problems)
+	}
+
+	path := filepath.Join(t.TempDir(), "mbox")
+	err = os.WriteFile(path, []byte(muttLengths), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err = RepairContentLength(path, nil)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("expected nothing to repair but got %v: %v", problems, err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil || string(raw) != muttLengths {
+		t.Errorf("expected the mbox left alone but got:\n%s", raw)
+	}
+}
+
+func TestRepairContentLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mbox")
+	err := os.WriteFile(path, []byte("junk first\n"+brokenLengths), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := RepairContentLength(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 3 {
+		t.Errorf("expected 3 problems but got %v", problems)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "junk first\n" + brokenLengths
+	expected = strings.Replace(expected, "Content-Length: 10\nSubject: Too short\n", "Subject: Too short\nContent-Length: 36\n", 1)
+	expected = strings.Replace(expected, "Subject: Missing\n", "Subject: Missing\nContent-Length: 20\n", 1)
+	expected = strings.Replace(expected, "Content-Length: 500\n", "Content-Length: 9\n", 1)
+	if string(raw) != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, raw)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected the permissions kept but got %v", info.Mode().Perm())
+	}
+
+	// The repaired mbox reads cleanly.
+	reader := NewReader(strings.NewReader(string(raw)))
+	reader.Type = MBOXCL2
+	count := 0
+	for reader.Next() {
+		count++
+	}
+	if reader.Err() != nil || count != 4 {
+		t.Errorf("expected 4 messages but got %d: %v", count, reader.Err())
+	}
+
+	problems, err = RepairContentLength(path, nil)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("expected nothing left to repair but got %v: %v", problems, err)
+	}
+}
+
+func TestVerifyContentLengthFromInBody(t *testing.T) {
+	// The wrong length mustn't make a message of the 'From ' line in the body.
+	mbox := "From a Mon Jul  4 14:23:45 2022\n" +
+		"Content-Length: 5\n" +
+		"\n" +
+		"Memo\n" +
+		"From the desk of Bob\n" +
+		"\n" +
+		"From b Mon Jul  4 14:23:46 2022\n" +
+		"Content-Length: 5\n" +
+		"\n" +
+		"last\n"
+	problems, err := VerifyContentLength(strings.NewReader(mbox), int64(len(mbox)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ContentLengthProblem{{Index: 0, Offset: 0, Declared: 5, Actual: 27}}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected:\n%v\nbut got:\n%v", expected, problems)
+	}
+}
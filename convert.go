@@ -0,0 +1,123 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// ConvertOptions describes how Convert works.
+type ConvertOptions struct {
+	DetectSource bool                 // Use DetectReader to work out the type of the source, ignoring srcType.
+	Warn         func(ConvertWarning) // Receives any warnings about individual messages.  Leave nil to ignore them.
+}
+
+// ConvertWarning describes something Convert could not translate faithfully.
+type ConvertWarning struct {
+	Index   int    // The position of the message within the source mbox.
+	Offset  int64  // The byte offset of the message within the source mbox.
+	From    string // The 'From ' line of the message.
+	Message string // A description of the problem.
+}
+
+// String describes the warning.
+func (w ConvertWarning) String() string {
+	return fmt.Sprintf("message %d at offset %d: %s", w.Index, w.Offset, w.Message)
+}
+
+// quotedFromMatch finds lines that start with any number of '>' characters
+// followed by 'From '.
+var quotedFromMatch = regexp.MustCompile(`(?m)^>+From `)
+
+// bareFromMatch finds lines that start with 'From '.
+var bareFromMatch = regexp.MustCompile(`(?m)^From `)
+
+// Convert streams the mbox in src, of type srcType, to dst as an mbox of type
+// dstType, returning the number of messages converted.  It buffers each
+// complete message through MboxReader.Next before writing it, so it streams
+// one message at a time, and a single large message still sits in memory.  It
+// keeps each message's 'From ' line.  When reading MBOXCL or MBOXCL2, or
+// writing either of them, it removes the 'Content-Length' header from each
+// message, leaving MboxWriter to add a correct one where needed.
+//
+// Some conversions can't be done faithfully.  An mboxo source can't tell a
+// body line starting with '>From ' from one that started with 'From ' and was
+// escaped, while an mboxo destination can't preserve the difference.  An
+// mboxcl2 destination can't hold a header line starting with 'From '.
+// Convert reports such messages through opts.Warn, along with 'From ' lines
+// lacking a date ParseFrom can make sense of.  If opts is nil, Convert uses
+// srcType and ignores warnings.
+func Convert(dst io.Writer, dstType int, src io.Reader, srcType int, opts *ConvertOptions) (count int, err error) {
+	if opts == nil {
+		opts = &ConvertOptions{}
+	}
+	if opts.DetectSource {
+		srcType, src, err = DetectReader(src)
+		if err != nil {
+			return 0, err
+		}
+	}
+	warn := func(msg *Message, text string) {
+		if opts.Warn != nil {
+			opts.Warn(ConvertWarning{Index: count, Offset: msg.Offset, From: msg.From, Message: text})
+		}
+	}
+
+	reader := NewReader(src)
+	reader.Type = srcType
+	writer := NewWriter(dst)
+	writer.Type = dstType
+	// Each message already sits in memory, so there's nothing to gain from
+	// spooling the bodies to temporary files.
+	writer.MemoryLimit = -1
+	stripLength := isContentLengthType(srcType) || isContentLengthType(dstType)
+	for reader.Next() {
+		msg := reader.Message()
+		if _, date, _, e := ParseFrom(msg.From); e != nil || date.IsZero() {
+			warn(msg, "unable to make sense of the date on the 'From ' line")
+		}
+		bodyStart := messageBodyStart(msg.raw)
+		body := msg.raw[bodyStart:]
+		if dstType == MBOXCL2 && bareFromMatch.Match(msg.raw[:bodyStart]) {
+			warn(msg, "mboxcl2 doesn't escape 'From ' lines, so a header starting with 'From ' will look like a new message")
+		}
+		if srcType == MBOXO && dstType != MBOXO && quotedFromMatch.Match(body) {
+			warn(msg, "mboxo can't tell whether a '>From ' line in the body was escaped, so it is kept as written")
+		}
+		if dstType == MBOXO && srcType != MBOXO && bareFromMatch.Match(body) {
+			warn(msg, "mboxo escapes 'From ' lines in the body in a way that can't be undone")
+		}
+		raw := msg.raw
+		if stripLength {
+			raw = rewriteHeader(raw, dropHeaders("Content-Length"), nil)
+		}
+		err = writer.WriteMail(msg.From, bytes.NewReader(raw))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, reader.Err()
+}
+
+// isContentLengthType determines whether the mbox type relies on the
+// 'Content-Length' header.
+func isContentLengthType(mboxType int) bool {
+	return mboxType == MBOXCL || mboxType == MBOXCL2
+}
+
+// messageBodyStart provides the offset of the body within raw, just past the
+// blank line ending the header, or the length of raw if it has no body.
+func messageBodyStart(raw []byte) int {
+	pos := 0
+	reader := bufio.NewReader(bytes.NewReader(raw))
+	for {
+		b, err := reader.ReadBytes('\n')
+		pos += len(b)
+		if err != nil || isBlankLine(b) {
+			return pos
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConvertOToCL2(t *testing.T) {
+	result := bytes.NewBuffer([]byte{})
+	warnings := []ConvertWarning{}
+	count, err := Convert(result, MBOXCL2, strings.NewReader(mboxo), MBOXO, &ConvertOptions{
+		Warn: func(w ConvertWarning) { warnings = append(warnings, w) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 messages but got %d", count)
+	}
+	expected := `From someone
+From: bubbles@bubbletown.com
+To: mrmxpdstk@lazytown.com
+Subject: To interpretation
+Content-Length: 42
+
+>From all of us, to all of you, be happy!
+From someone-else
+From: mrspam@corporate.corp.com
+To: mrmxpdstk@lazytown.com
+Subject: Bestest offer in the universe!!11!!
+Content-Length: 130
+
+You won't believe these prices!
+>From 1 cent to 11 cents, we carry the least expensive
+line of jets this side of the Gobi Desert!
+`
+	CompareBodies(expected, result.String(), t)
+
+	// Both messages have ambiguous '>From ' lines, and neither 'From ' line
+	// holds a date.
+	ambiguous := 0
+	for _, w := range warnings {
+		if strings.Contains(w.Message, "escaped") {
+			ambiguous++
+		}
+	}
+	if ambiguous != 2 {
+		t.Errorf("expected 2 ambiguous quoting warnings but got %d: %v", ambiguous, warnings)
+	}
+	if len(warnings) != 4 {
+		t.Errorf("expected 4 warnings but got %d: %v", len(warnings), warnings)
+	}
+	if warnings[len(warnings)-1].Index != 1 || warnings[len(warnings)-1].Offset != int64(strings.Index(mboxo, "From someone-else")) {
+		t.Errorf("unexpected warning %s", warnings[len(warnings)-1])
+	}
+}
+
+func TestConvertCLToRD(t *testing.T) {
+	result := bytes.NewBuffer([]byte{})
+	count, err := Convert(result, MBOXRD, strings.NewReader(mboxcl), MBOXCL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	if strings.Contains(result.String(), "Content-Length") {
+		t.Errorf("expected the Content-Length headers to be removed")
+	}
+	box := NewReader(result)
+	box.Type = MBOXRD
+	bodies := []string{}
+	for box.Next() {
+		b := new(bytes.Buffer)
+		b.ReadFrom(box.Message().Body)
+		bodies = append(bodies, b.String())
+	}
+	if len(bodies) != 3 || bodies[0] != "From all of us, to all of you, be happy!\n\n" {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+}
+
+func TestConvertCLToCL2RoundTrip(t *testing.T) {
+	// A header starting with 'From ' can't survive mboxcl2.
+	warnings := []ConvertWarning{}
+	_, err := Convert(io.Discard, MBOXCL2, strings.NewReader(mboxcl), MBOXCL, &ConvertOptions{
+		Warn: func(w ConvertWarning) { warnings = append(warnings, w) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, w := range warnings {
+		if w.Index == 1 && strings.Contains(w.Message, "header") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a warning about the header starting with 'From ': %v", warnings)
+	}
+
+	source := strings.Replace(mboxcl, ">From mug: weird header\n", "", 1)
+	middle := bytes.NewBuffer([]byte{})
+	_, err = Convert(middle, MBOXCL2, strings.NewReader(source), MBOXCL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(middle.String(), "Content-Length") != 3 {
+		t.Errorf("expected exactly one Content-Length per message:\n%s", middle.String())
+	}
+	result := bytes.NewBuffer([]byte{})
+	_, err = Convert(result, MBOXCL, bytes.NewReader(middle.Bytes()), MBOXCL2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(source, "From someone-else\nContent-Length: 130\n", "From someone-else\n", 1)
+	expected = strings.Replace(expected, "Subject: Bestest offer in the universe!!11!!\n", "Subject: Bestest offer in the universe!!11!!\nContent-Length: 130\n", 1)
+	CompareBodies(expected, result.String(), t)
+}
+
+func TestConvertDetect(t *testing.T) {
+	result := bytes.NewBuffer([]byte{})
+	warnings := 0
+	_, err := Convert(result, MBOXO, strings.NewReader(mboxcl), -1, &ConvertOptions{
+		DetectSource: true,
+		Warn:         func(w ConvertWarning) { warnings++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(result.String(), "Content-Length") {
+		t.Errorf("expected the Content-Length headers to be removed")
+	}
+	if warnings == 0 {
+		t.Errorf("expected warnings about lossy mboxo escaping")
+	}
+
+	// Detecting the type shouldn't need to seek.
+	result.Reset()
+	count, err := Convert(result, MBOXO, bytes.NewBufferString(mboxcl), -1, &ConvertOptions{DetectSource: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	_, err = Convert(result, MBOXO, strings.NewReader(badmboxcl), MBOXCL, nil)
+	if err == nil {
+		t.Errorf("expected an error for a broken mbox")
+	}
+}
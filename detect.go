@@ -2,6 +2,7 @@ package mbox
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"regexp"
@@ -15,7 +16,8 @@ func lineFeedType(reader io.ReadSeeker) (bool, error) {
 		return false, err
 	}
 	b := make([]byte, 1024)
-	for count, err := reader.Read(b); err == nil; {
+	for {
+		count, err := reader.Read(b)
 		for i := 0; i < count; i++ {
 			if b[i] == '\r' {
 				return true, nil
@@ -24,16 +26,58 @@ func lineFeedType(reader io.ReadSeeker) (bool, error) {
 				return false, nil
 			}
 		}
+		if err != nil {
+			break
+		}
 	}
 	return false, fmt.Errorf("no carriage return or line feed")
 }
 
+// DetectReader works out the type of mbox read holds, as DetectType does, for
+// streams that can't seek, such as standard input or an HTTP body.  It looks
+// at no more than the first megabyte or so of read, and returns a reader that
+// replays those bytes followed by the rest of read, ready for NewReader.
+// Since it only sees part of the mbox, it may guess differently than
+// DetectType would for the whole thing.
+func DetectReader(read io.Reader) (mboxType int, replay io.Reader, err error) {
+	buffered := bufio.NewReaderSize(read, detectSampleSize)
+	sample, err := buffered.Peek(detectSampleSize)
+	if err != nil && err != io.EOF {
+		return -1, buffered, err
+	}
+	if len(sample) == 0 {
+		// There's nothing to go on, but nothing to misread either.
+		return MBOXO, buffered, nil
+	}
+	mboxType, err = DetectType(bytes.NewReader(sample))
+	return mboxType, buffered, err
+}
+
+// startsWith determines whether the reader begins with the prefix.
+func startsWith(reader io.ReadSeeker, prefix string) (bool, error) {
+	_, err := reader.Seek(0, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+	b := make([]byte, len(prefix))
+	_, err = io.ReadFull(reader, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return string(b) == prefix, nil
+}
+
 // DetectType attempts to figure out the type of mbox the reader holds.  This
 // is a best-effort attempt to determine the type of mbox file format based on
 // what it sees within the text.  When it returns, it attempts to move reader
 // to the beginning of the stream on exit.
 //
 // It tries to work out the type of file by:
+//   - Looking for the MMDF delimiter or the 'BABYL OPTIONS:' header at the
+//     very start of the file
 //   - Looking for 'Content-Length' in a message's header
 //   - Looking for '>From ' or '>>From ' (or any number of > character in front
 //     of "From "') in the message's body.
@@ -41,10 +85,28 @@ func lineFeedType(reader io.ReadSeeker) (bool, error) {
 //     the body of the message is complete.
 //
 // With this information, it can guess if the mbox matches one of the file
-// types supported by this library with some degree of certainty.
+// types supported by this library with some degree of certainty.  When the
+// evidence doesn't settle the matter, it guesses anyway; use Detect to find
+// out how sure it can be.
 func DetectType(reader io.ReadSeeker) (mboxType int, err error) {
 	rdMatch := regexp.MustCompile(`^>*>From `)
 	clMatch := regexp.MustCompile(`^Content-Length:`)
+	for _, start := range []struct {
+		prefix   string
+		mboxType int
+	}{
+		{mmdfDelimiter, MMDF},
+		{babylOptions, BABYL},
+	} {
+		found, err := startsWith(reader, start.prefix)
+		if err != nil {
+			return -1, err
+		}
+		if found {
+			_, err = reader.Seek(0, io.SeekStart)
+			return start.mboxType, err
+		}
+	}
 	feedType, err := lineFeedType(reader)
 	if err != nil {
 		return -1, err
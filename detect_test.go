@@ -1,6 +1,8 @@
 package mbox_test
 
 import (
+	"bytes"
+	"io"
 	"strings"
 	"testing"
 
@@ -163,3 +165,139 @@ func TestDetectAltLinefeed(t *testing.T) {
 	}
 
 }
+
+func TestDetectLongFirstLine(t *testing.T) {
+	mb := "From " + strings.Repeat("x", 2000) + "\nSubject: Long\n\nBody\n"
+	mType, err := mbox.DetectType(strings.NewReader(mb))
+	if err != nil {
+		t.Error(err)
+	}
+	if mType != mbox.MBOXO {
+		t.Errorf("expected %d but got %d", mbox.MBOXO, mType)
+	}
+}
+
+func TestDetectReader(t *testing.T) {
+	// Make an mbox longer than DetectReader will look at, with the evidence
+	// at the start.
+	mb := bytes.NewBufferString("From someone\nSubject: Evidence\n\n>From here on\n")
+	for mb.Len() < 3<<20 {
+		mb.WriteString("From someone\nSubject: Filler\n\n" + strings.Repeat("filler ", 100) + "\n")
+	}
+	expected := mb.String()
+	// Hide everything but Read, as if reading standard input.
+	mType, replay, err := mbox.DetectReader(io.MultiReader(mb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mType != mbox.MBOXRD {
+		t.Errorf("expected %d but got %d", mbox.MBOXRD, mType)
+	}
+	all, err := io.ReadAll(replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(all) != expected {
+		t.Errorf("expected the replay to return all %d bytes but got %d", len(expected), len(all))
+	}
+
+	mType, replay, err = mbox.DetectReader(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mType != mbox.MBOXO {
+		t.Errorf("expected %d for an empty stream but got %d", mbox.MBOXO, mType)
+	}
+	if all, _ := io.ReadAll(replay); len(all) != 0 {
+		t.Errorf("expected nothing to replay but got %q", all)
+	}
+}
+
+func TestDetectReport(t *testing.T) {
+	tests := []struct {
+		name      string
+		mbox      string
+		expected  int
+		ambiguous bool
+	}{
+		{"mboxo", "From a\nSubject: One\n\nHello\n\nFrom b\nSubject: Two\n\nThere\n", mbox.MBOXO, true},
+		{"mboxrd", "From a\nSubject: One\n\n>From here\n\nFrom b\nSubject: Two\n\nThere\n", mbox.MBOXRD, false},
+		{"mboxcl", "From a\nContent-Length: 12\n\n>From here\n\nFrom b\nContent-Length: 6\n\nThere\n", mbox.MBOXCL, false},
+		{"mboxcl2", "From a\nContent-Length: 11\n\nFrom here\n\nFrom b\nContent-Length: 6\n\nThere\n", mbox.MBOXCL2, false},
+		{"mboxcl unknown", "From a\nContent-Length: 6\n\nHello\nFrom b\nContent-Length: 6\n\nThere\n", mbox.MBOXCL, true},
+		{"mmdf", "\x01\x01\x01\x01\nSubject: One\n\nHello\n\x01\x01\x01\x01\n", mbox.MMDF, false},
+		{"babyl", "BABYL OPTIONS: -*- rmail -*-\n\x1f", mbox.BABYL, false},
+		{"nothing", "Just some text.\n", -1, true},
+	}
+	for _, test := range tests {
+		report, err := mbox.Detect(strings.NewReader(test.mbox), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Type != test.expected {
+			t.Errorf("%s: expected %d but got %d (%v)", test.name, test.expected, report.Type, report.Scores)
+		}
+		if report.Ambiguous() != test.ambiguous {
+			t.Errorf("%s: expected ambiguous %v (%v)", test.name, test.ambiguous, report.Scores)
+		}
+	}
+}
+
+func TestDetectReportEvidence(t *testing.T) {
+	mb := "From a\r\nContent-Length: 24\r\n\r\nFrom here\r\n>From there\r\nFrom b\r\nContent-Length: 999\r\n\r\nShort\r\n"
+	report, err := mbox.Detect(strings.NewReader(mb), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Messages != 2 || report.ContentLength != 2 {
+		t.Errorf("expected 2 messages and Content-Length headers but got %d and %d", report.Messages, report.ContentLength)
+	}
+	if report.ContentLengthMatches != 1 || report.ContentLengthMismatches != 1 {
+		t.Errorf("expected 1 match and mismatch but got %d and %d", report.ContentLengthMatches, report.ContentLengthMismatches)
+	}
+	if report.BareFrom != 1 || report.QuotedFrom != 1 {
+		t.Errorf("expected 1 bare and quoted From line but got %d and %d", report.BareFrom, report.QuotedFrom)
+	}
+	if report.LineEnding != "\r\n" {
+		t.Errorf("expected CRLF line endings but got %q", report.LineEnding)
+	}
+	if report.Truncated || report.Sampled != int64(len(mb)) {
+		t.Errorf("expected the whole sample but got %d bytes, truncated %v", report.Sampled, report.Truncated)
+	}
+	if !report.Ambiguous() {
+		t.Errorf("expected contradictory evidence to be ambiguous: %v", report.Scores)
+	}
+
+	report, err = mbox.Detect(strings.NewReader(mb+"From c\nContent-Length: 0\n\n"), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Truncated || report.Sampled != 30 || report.SampleLimit != 30 {
+		t.Errorf("expected a truncated sample of 30 bytes but got %d, truncated %v", report.Sampled, report.Truncated)
+	}
+	if report.LineEnding != "\r\n" {
+		t.Errorf("expected CRLF line endings but got %q", report.LineEnding)
+	}
+	if report.ContentLengthMatches+report.ContentLengthMismatches != 0 {
+		t.Errorf("expected no lengths checked past the sample but got %d", report.ContentLengthMatches+report.ContentLengthMismatches)
+	}
+
+	report, err = mbox.Detect(strings.NewReader("From a\nSubject: x\r\n\nBody\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.LineEnding != "mixed" {
+		t.Errorf("expected mixed line endings but got %q", report.LineEnding)
+	}
+}
+
+func TestDetectReportHugeLength(t *testing.T) {
+	mb := "From a Mon Jan  1 00:00:00 2024\nContent-Length: 9223372036854775807\n\nbody\n"
+	report, err := mbox.Detect(strings.NewReader(mb), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ContentLengthMismatches != 1 {
+		t.Errorf("expected the length to mismatch but got %d mismatches", report.ContentLengthMismatches)
+	}
+}
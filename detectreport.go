@@ -0,0 +1,238 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// detectAmbiguousMargin describes how far ahead of the runner-up the best
+// score in a DetectReport must be for the result to count as clear.
+const detectAmbiguousMargin = 0.2
+
+// detectTypes lists the types DetectReport scores, in the order that breaks
+// ties.
+var detectTypes = []int{MBOXO, MBOXRD, MBOXCL, MBOXCL2, MMDF, BABYL}
+
+// DetectReport describes what Detect found while working out the type of an
+// mbox, so one may judge how far to trust its conclusion.
+type DetectReport struct {
+	Type                    int             // The type with the best score, or -1 if nothing looked like an mbox.
+	Scores                  map[int]float64 // How well the sample fits each type, from 0 (not at all) to 1 (certainly).
+	Messages                int             // The number of messages found in the sample.
+	QuotedFrom              int             // The number of body lines starting with one or more '>' characters followed by 'From '.
+	ContentLength           int             // The number of 'Content-Length' headers found.
+	ContentLengthMatches    int             // The number of 'Content-Length' values that end the body just before the next 'From ' line.
+	ContentLengthMismatches int             // The number of 'Content-Length' values that don't.
+	BareFrom                int             // The number of lines starting with 'From ' inside bodies measured by a matching 'Content-Length'.
+	LineEnding              string          // The line ending used: "\n", "\r\n", "mixed", or empty if the sample holds no complete line.
+	SampleLimit             int64           // The most bytes Detect would look at.
+	Sampled                 int64           // The number of bytes Detect looked at.
+	Truncated               bool            // Whether the mbox continues past the sample.
+}
+
+// Detect works out the type of mbox read holds, like DetectType, but reports
+// the evidence it found and how strongly it supports each type, rather than
+// guessing when the evidence runs out.  It reads no more than limit bytes
+// from read, or about a megabyte if limit isn't positive.
+func Detect(read io.Reader, limit int64) (report *DetectReport, err error) {
+	if limit <= 0 {
+		limit = detectSampleSize
+	}
+	sample, err := io.ReadAll(io.LimitReader(read, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	report = &DetectReport{Scores: map[int]float64{}, SampleLimit: limit}
+	if int64(len(sample)) > limit {
+		report.Truncated = true
+		sample = sample[:limit]
+	}
+	report.Sampled = int64(len(sample))
+	report.LineEnding = sampleLineEnding(sample)
+	switch {
+	case bytes.HasPrefix(sample, []byte(mmdfDelimiter)):
+		report.Scores[MMDF] = 1
+	case bytes.HasPrefix(sample, []byte(babylOptions)):
+		report.Scores[BABYL] = 1
+	default:
+		report.scan(sample)
+		report.score()
+	}
+	report.Type = -1
+	best := 0.0
+	for _, t := range detectTypes {
+		if report.Scores[t] > best {
+			report.Type = t
+			best = report.Scores[t]
+		}
+	}
+	return report, nil
+}
+
+// Ambiguous determines whether the evidence fails to settle on a type: when
+// the best score falls below one half, or when another type scores nearly as
+// well.  A sample without escaped or unescaped 'From ' lines in its bodies,
+// for example, fits mboxo and mboxrd equally well.
+func (r *DetectReport) Ambiguous() bool {
+	scores := []float64{0, 0}
+	for _, t := range detectTypes {
+		scores = append(scores, r.Scores[t])
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(scores)))
+	return scores[0] < 0.5 || scores[0]-scores[1] < detectAmbiguousMargin
+}
+
+// sampleLineEnding works out the line ending used within the sample.
+func sampleLineEnding(sample []byte) string {
+	lf := bytes.Count(sample, []byte("\n"))
+	crlf := bytes.Count(sample, []byte("\r\n"))
+	switch {
+	case lf == 0:
+		return ""
+	case crlf == lf:
+		return "\r\n"
+	case crlf == 0:
+		return "\n"
+	}
+	return "mixed"
+}
+
+// sampleLine provides the line starting at pos within the sample, including
+// its line ending.
+func sampleLine(sample []byte, pos int) []byte {
+	i := bytes.IndexByte(sample[pos:], '\n')
+	if i < 0 {
+		return sample[pos:]
+	}
+	return sample[pos : pos+i+1]
+}
+
+// scan walks the messages in the sample, gathering evidence.
+func (r *DetectReport) scan(sample []byte) {
+	from := []byte("From ")
+	pos := 0
+	// Anything preceding the first 'From ' line isn't part of a message.
+	for pos < len(sample) && !bytes.HasPrefix(sample[pos:], from) {
+		pos += len(sampleLine(sample, pos))
+	}
+	for pos < len(sample) {
+		r.Messages++
+		pos += len(sampleLine(sample, pos))
+		length := -1
+		for pos < len(sample) {
+			line := sampleLine(sample, pos)
+			pos += len(line)
+			if isBlankLine(line) {
+				break
+			}
+			name, value, found := strings.Cut(string(line), ":")
+			if found && strings.EqualFold(name, "Content-Length") {
+				r.ContentLength++
+				if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n >= 0 {
+					length = n
+				}
+			}
+		}
+
+		if length >= 0 {
+			// Compare against what's left rather than adding, since a huge
+			// length would overflow.
+			left := len(sample) - pos
+			switch {
+			case length >= left && r.Truncated:
+				// The body runs past the sample, so we can't check it.
+				r.scanBody(sample[pos:], true)
+				return
+			case length <= left && lengthEndsBody(sample[pos+length:]):
+				r.ContentLengthMatches++
+				r.scanBody(sample[pos:pos+length], true)
+				pos += length
+				for pos < len(sample) && !bytes.HasPrefix(sample[pos:], from) {
+					pos += len(sampleLine(sample, pos))
+				}
+				continue
+			default:
+				r.ContentLengthMismatches++
+			}
+		}
+
+		// Without a trustworthy length, the next 'From ' line ends the body.
+		end := pos
+		for end < len(sample) && !bytes.HasPrefix(sample[end:], from) {
+			end += len(sampleLine(sample, end))
+		}
+		r.scanBody(sample[pos:end], false)
+		pos = end
+	}
+}
+
+// lengthEndsBody determines whether a body measured by 'Content-Length' ends
+// just before rest: the end of the mbox, or the next 'From ' line, perhaps
+// after a blank line.
+func lengthEndsBody(rest []byte) bool {
+	if len(rest) == 0 {
+		return true
+	}
+	rest = bytes.TrimPrefix(rest, []byte("\r"))
+	rest = bytes.TrimPrefix(rest, []byte("\n"))
+	return len(rest) == 0 || bytes.HasPrefix(rest, []byte("From "))
+}
+
+// scanBody counts the escaped 'From ' lines in the body, and the unescaped
+// ones if measured tells us the body's length came from 'Content-Length'.
+func (r *DetectReport) scanBody(body []byte, measured bool) {
+	for pos := 0; pos < len(body); {
+		line := sampleLine(body, pos)
+		pos += len(line)
+		if quotedFromMatch.Match(line) {
+			r.QuotedFrom++
+		} else if measured && bytes.HasPrefix(line, []byte("From ")) {
+			r.BareFrom++
+		}
+	}
+}
+
+// score weighs the evidence for each of the 'From ' line delimited types.
+func (r *DetectReport) score() {
+	if r.Messages == 0 {
+		return
+	}
+	if r.ContentLength == 0 {
+		if r.QuotedFrom > 0 {
+			// Both escape 'From ' lines, but mboxo leaves a quoted line
+			// looking the same as an escaped one, so mboxrd fits better.
+			r.Scores[MBOXRD] = 0.8
+			r.Scores[MBOXO] = 0.4
+		} else {
+			r.Scores[MBOXO] = 0.5
+			r.Scores[MBOXRD] = 0.5
+		}
+		return
+	}
+
+	fit := 0.5
+	if checked := r.ContentLengthMatches + r.ContentLengthMismatches; checked > 0 {
+		fit = float64(r.ContentLengthMatches) / float64(checked)
+	}
+	switch {
+	case r.QuotedFrom > 0 && r.BareFrom == 0:
+		r.Scores[MBOXCL] = fit
+		r.Scores[MBOXCL2] = fit * 0.3
+	case r.BareFrom > 0 && r.QuotedFrom == 0:
+		r.Scores[MBOXCL2] = fit
+		r.Scores[MBOXCL] = fit * 0.3
+	default:
+		// Nothing, or contradictory evidence, to tell them apart.
+		r.Scores[MBOXCL] = fit * 0.5
+		r.Scores[MBOXCL2] = fit * 0.5
+	}
+	// Lengths that don't line up suggest the headers mean nothing to the mbox.
+	r.Scores[MBOXO] = (1 - fit) * 0.5
+	r.Scores[MBOXRD] = (1 - fit) * 0.5
+	if r.QuotedFrom > 0 {
+		r.Scores[MBOXRD] = (1 - fit) * 0.8
+	}
+}
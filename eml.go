@@ -0,0 +1,165 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// emlFromHeader holds a message's 'From ' line within an .eml file.
+const emlFromHeader = "X-Mbox-From"
+
+// emlSubjectLength limits how much of the subject goes into an .eml file name.
+const emlSubjectLength = 60
+
+// EMLOptions describes how ExportEML works.
+type EMLOptions struct {
+	KeepFrom bool // Keep each message's 'From ' line in an 'X-Mbox-From' header, which ImportEML uses in turn.
+}
+
+// emlName provides the file name for the message at index, from the date on
+// its 'From ' line and its subject.  The index keeps names unique, while the
+// rest helps people find a message.
+func emlName(index int, date time.Time, subject string) string {
+	stamp := "nodate"
+	if !date.IsZero() {
+		stamp = date.UTC().Format("20060102T150405Z")
+	}
+	decoder := &mime.WordDecoder{}
+	if decoded, err := decoder.DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	clean := []rune{}
+	for _, c := range subject {
+		if unicode.IsLetter(c) || unicode.IsNumber(c) || c == '-' {
+			clean = append(clean, c)
+		} else if len(clean) > 0 && clean[len(clean)-1] != '_' {
+			clean = append(clean, '_')
+		}
+		if len(clean) >= emlSubjectLength {
+			break
+		}
+	}
+	name := strings.Trim(string(clean), "_")
+	if len(name) == 0 {
+		name = "nosubject"
+	}
+	return fmt.Sprintf("%06d_%s_%s.eml", index, stamp, name)
+}
+
+// ExportEML writes each message read by reader into its own .eml file within
+// dir, creating dir if needed.  It names each file after the message's place
+// in the mbox (counting from 1), the date on its 'From ' line and its
+// subject, so exporting the same mbox always produces the same names.  Each
+// file's modification time records the date from the 'From ' line.  It
+// refuses to replace files already in dir.  If opts is nil, ExportEML uses
+// the defaults.  It returns the number of messages exported.
+func ExportEML(dir string, reader *MboxReader, opts *EMLOptions) (count int, err error) {
+	if opts == nil {
+		opts = &EMLOptions{}
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return 0, err
+	}
+	for reader.Next() {
+		msg := reader.Message()
+		raw := msg.raw
+		if opts.KeepFrom {
+			raw = rewriteHeader(raw, dropHeaders(emlFromHeader), []string{emlFromHeader + ": " + msg.From})
+		}
+		path := filepath.Join(dir, emlName(count+1, msg.Date, msg.Header.Get("Subject")))
+		err = writeNewFile(path, raw)
+		if err == nil && !msg.Date.IsZero() {
+			err = os.Chtimes(path, msg.Date, msg.Date)
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, reader.Err()
+}
+
+// emlEntry describes an .eml file found by ImportEML.
+type emlEntry struct {
+	path string
+	date time.Time
+}
+
+// ImportEML writes each .eml file in dir to writer, ordered by the 'Date'
+// header of each message, or the file's modification time for messages
+// lacking a usable one.  It takes each message's 'From ' line from its
+// 'X-Mbox-From' header, removing the header, or builds one from its
+// 'Return-Path' header and date.  It returns the number of messages imported.
+func ImportEML(dir string, writer *MboxWriter) (count int, err error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	entries := []emlEntry{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(strings.ToLower(file.Name()), ".eml") {
+			continue
+		}
+		entry := emlEntry{path: filepath.Join(dir, file.Name())}
+		raw, err := os.ReadFile(entry.path)
+		if err != nil {
+			return 0, err
+		}
+		entry.date, err = emlDate(raw)
+		if err != nil {
+			info, err := file.Info()
+			if err != nil {
+				return 0, err
+			}
+			entry.date = info.ModTime()
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].date.Equal(entries[j].date) {
+			return entries[i].path < entries[j].path
+		}
+		return entries[i].date.Before(entries[j].date)
+	})
+
+	for _, entry := range entries {
+		raw, err := os.ReadFile(entry.path)
+		if err != nil {
+			return count, err
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			return count, fmt.Errorf("unable to read %s: %s", entry.path, err)
+		}
+		from := msg.Header.Get(emlFromHeader)
+		if len(from) > 0 {
+			raw = rewriteHeader(raw, dropHeaders(emlFromHeader), nil)
+		} else {
+			from = senderFrom(msg.Header, entry.date)
+		}
+		err = writer.WriteMail(from, bytes.NewReader(raw))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// emlDate provides the date in the message's 'Date' header.
+func emlDate(raw []byte) (result time.Time, err error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return result, err
+	}
+	return msg.Header.Date()
+}
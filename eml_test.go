@@ -0,0 +1,116 @@
+package mbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEMLName(t *testing.T) {
+	date := time.Date(2022, 7, 4, 14, 23, 45, 0, time.UTC)
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{"To interpretation", "000007_20220704T142345Z_To_interpretation.eml"},
+		{"Re: ../../etc/passwd?!", "000007_20220704T142345Z_Re_etc_passwd.eml"},
+		{"=?UTF-8?Q?Caf=C3=A9_time?=", "000007_20220704T142345Z_Café_time.eml"},
+		{"", "000007_20220704T142345Z_nosubject.eml"},
+		{strings.Repeat("a", 100), "000007_20220704T142345Z_" + strings.Repeat("a", 60) + ".eml"},
+	}
+	for _, test := range tests {
+		if name := emlName(7, date, test.subject); name != test.expected {
+			t.Errorf("expected %q but got %q", test.expected, name)
+		}
+	}
+	if name := emlName(1, time.Time{}, "Hi"); name != "000001_nodate_Hi.eml" {
+		t.Errorf("unexpected name without a date: %q", name)
+	}
+}
+
+func TestEMLRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	reader := NewReader(strings.NewReader(maildirMbox))
+	reader.Type = MBOXRD
+	count, err := ExportEML(dir, reader, &EMLOptions{KeepFrom: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	expected := "000001_20220704T142345Z_Read_and_flagged.eml 000002_20220704T150215Z_Brand_new.eml 000003_20220704T130000Z_Answered_and_deleted.eml"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("expected %s but got %s", expected, strings.Join(names, " "))
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, names[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "From: mrspam@corporate.corp.com\nSubject: Brand new\nX-Mbox-From: From mrspam@corporate.corp.com Mon Jul  4 15:02:15 2022\n\nBuy now.\n" {
+		t.Errorf("unexpected file: %q", raw)
+	}
+
+	// Without Date headers, the import relies on the modification times,
+	// which put the last message first.
+	buf := bytes.NewBuffer([]byte{})
+	writer := NewWriter(buf)
+	writer.Type = MBOXRD
+	count, err = ImportEML(dir, writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	direct := bytes.NewBuffer([]byte{})
+	_, err = Convert(direct, MBOXRD, strings.NewReader(maildirMbox), MBOXRD, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := strings.Split(direct.String(), "\n\nFrom ")
+	reordered := "From " + messages[2] + messages[0] + "\n\nFrom " + messages[1] + "\n\n"
+	if buf.String() != reordered {
+		t.Errorf("expected:\n%s\nbut got:\n%s", reordered, buf.String())
+	}
+}
+
+func TestImportEMLDateHeader(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.eml":  "Return-Path: <late@example.com>\nDate: Tue, 05 Jul 2022 09:00:00 +0000\n\nLate.\n",
+		"b.EML":  "Return-Path: <early@example.com>\nDate: Mon, 04 Jul 2022 09:00:00 +0000\n\nEarly.\n",
+		"c.txt":  "Not a message.\n",
+		"d.eml~": "Not a message either.\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := bytes.NewBuffer([]byte{})
+	count, err := ImportEML(dir, NewWriter(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 messages but got %d", count)
+	}
+	expected := "From early@example.com Mon Jul  4 09:00:00 2022\nReturn-Path: <early@example.com>\nDate: Mon, 04 Jul 2022 09:00:00 +0000\n\nEarly.\n\n" +
+		"From late@example.com Tue Jul  5 09:00:00 2022\nReturn-Path: <late@example.com>\nDate: Tue, 05 Jul 2022 09:00:00 +0000\n\nLate.\n\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
@@ -41,6 +41,10 @@ func ExampleDetectType() {
 		fmt.Println("MBOXCL")
 	case mbox.MBOXCL2:
 		fmt.Println("MBOXCL2")
+	case mbox.MMDF:
+		fmt.Println("MMDF")
+	case mbox.BABYL:
+		fmt.Println("BABYL")
 	default:
 		fmt.Println("Unknown")
 	}
@@ -0,0 +1,202 @@
+package mbox
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ExpungeOptions describes how Expunge rewrites an mbox.
+type ExpungeOptions struct {
+	Lock    *LockOptions // The locks to hold while rewriting the mbox.  Leave nil to skip locking.
+	InPlace bool         // Shift surviving messages down within the file instead of writing a temporary file and renaming it over the mbox.
+}
+
+// Compact copies the mbox in src, described by idx, to dst, leaving out each
+// message n for which remove(n) returns true.  It copies everything else byte
+// for byte, including anything preceding the first message.
+func Compact(dst io.Writer, src io.ReaderAt, idx *Index, remove func(n int) bool) (err error) {
+	if len(idx.Entries) == 0 {
+		return nil
+	}
+	_, err = io.Copy(dst, io.NewSectionReader(src, 0, idx.Entries[0].From))
+	if err != nil {
+		return err
+	}
+	for n, entry := range idx.Entries {
+		if remove(n) {
+			continue
+		}
+		_, err = io.Copy(dst, io.NewSectionReader(src, entry.From, entry.BodyEnd-entry.From))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expunge removes each message from the mbox at path for which remove returns
+// true, preserving the mbox type and the exact bytes of every other message.
+// The remove function receives the position of each message within the mbox
+// along with the message itself.  It returns the number of messages removed.
+//
+// By default, Expunge writes the surviving messages to a temporary file in
+// the same folder and renames it over the mbox once complete, so a failure
+// never damages the mbox.  Note that flock and fcntl locks belong to the
+// original file, so other processes relying on them won't see the lock on the
+// replacement; use a dotlock or set InPlace in that case.  InPlace shifts the
+// surviving messages down within the original file and truncates it, which
+// keeps every lock meaningful, but a crash part way through leaves the mbox
+// damaged.  If opts is nil, Expunge uses a temporary file and no locks.
+func Expunge(path string, mboxType int, remove func(n int, msg *Message) bool, opts *ExpungeOptions) (removed int, err error) {
+	return expunge(path, mboxType, func(n int, random *RandomReader) (bool, error) {
+		msg, err := random.Message(n)
+		if err != nil {
+			return false, err
+		}
+		return remove(n, msg), nil
+	}, opts)
+}
+
+// ExpungeIndices removes the messages at the given positions within the mbox
+// at path, just as Expunge does.  It ignores positions that don't exist.
+func ExpungeIndices(path string, mboxType int, indices []int, opts *ExpungeOptions) (removed int, err error) {
+	doomed := map[int]bool{}
+	for _, n := range indices {
+		doomed[n] = true
+	}
+	return expunge(path, mboxType, func(n int, random *RandomReader) (bool, error) {
+		return doomed[n], nil
+	}, opts)
+}
+
+// expunge does the work of Expunge and ExpungeIndices.  The remove function
+// decides the fate of each message, reading it from random only if it needs
+// to, so removing messages by position never parses them.
+func expunge(path string, mboxType int, remove func(n int, random *RandomReader) (bool, error), opts *ExpungeOptions) (removed int, err error) {
+	if opts == nil {
+		opts = &ExpungeOptions{}
+	}
+	file, closer, err := openMailbox(path, opts.Lock)
+	if err != nil {
+		return 0, err
+	}
+	defer closer()
+	idx, err := indexFile(file, mboxType)
+	if err != nil {
+		return 0, err
+	}
+	random := NewRandomReader(file, idx)
+	doomed := map[int]bool{}
+	for n := range idx.Entries {
+		gone, err := remove(n, random)
+		if err != nil {
+			return 0, err
+		}
+		if gone {
+			doomed[n] = true
+		}
+	}
+	if len(doomed) == 0 {
+		return 0, nil
+	}
+	if opts.InPlace {
+		err = shiftMailbox(file, idx, doomed)
+	} else {
+		err = replaceMailbox(path, file, func(dst io.Writer) error {
+			return Compact(dst, file, idx, func(n int) bool { return doomed[n] })
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(doomed), nil
+}
+
+// openMailbox opens the mbox at path for reading and writing, holding the
+// described locks if lock isn't nil.  Call closer when finished.
+func openMailbox(path string, lock *LockOptions) (file *os.File, closer func() error, err error) {
+	if lock == nil {
+		file, err = os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, file.Close, nil
+	}
+	box, err := OpenLocked(path, os.O_RDWR, 0, lock)
+	if err != nil {
+		return nil, nil, err
+	}
+	return box.File, box.Close, nil
+}
+
+// indexFile builds an index for the whole of file.
+func indexFile(file *os.File, mboxType int) (idx *Index, err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return BuildIndex(io.NewSectionReader(file, 0, info.Size()), mboxType)
+}
+
+// replaceMailbox has fn write the new contents of the mbox at path into a
+// temporary file beside it, then renames the temporary file over the mbox,
+// keeping the original's permissions.
+func replaceMailbox(path string, file *os.File, fn func(dst io.Writer) error) (err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"_*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = fn(tmp)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// shiftMailbox removes the doomed messages from file by moving the remaining
+// messages down over them, then truncating the file.
+func shiftMailbox(file *os.File, idx *Index, doomed map[int]bool) (err error) {
+	kept := []IndexEntry{}
+	for n, entry := range idx.Entries {
+		if !doomed[n] {
+			kept = append(kept, entry)
+		}
+	}
+	write := int64(0)
+	if len(idx.Entries) > 0 {
+		write = idx.Entries[0].From
+	}
+	for _, entry := range kept {
+		size := entry.BodyEnd - entry.From
+		if write != entry.From {
+			// We always write below where we read, so the copy never
+			// overwrites anything it has yet to read.
+			_, err = io.Copy(io.NewOffsetWriter(file, write), io.NewSectionReader(file, entry.From, size))
+			if err != nil {
+				return err
+			}
+		}
+		write += size
+	}
+	err = file.Truncate(write)
+	if err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,102 @@
+package mbox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpunge(t *testing.T) {
+	for _, inPlace := range []bool{false, true} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "mbox")
+		err := os.WriteFile(path, []byte(mboxcl), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := &ExpungeOptions{Lock: &LockOptions{Methods: []LockMethod{LockDotlock}}, InPlace: inPlace}
+		removed, err := Expunge(path, MBOXCL, func(n int, msg *Message) bool {
+			return msg.Header.Get("Subject") == "Bestest offer in the universe!!11!!"
+		}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != 1 {
+			t.Errorf("expected to remove 1 message but removed %d", removed)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second := strings.Index(mboxcl, "From someone-else\n")
+		third := strings.Index(mboxcl, "From nobody\n")
+		CompareBodies(mboxcl[:second]+mboxcl[third:], string(b), t)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("expected permissions 0640 but got %o", info.Mode().Perm())
+		}
+		_, err = os.Stat(path + ".lock")
+		if !os.IsNotExist(err) {
+			t.Errorf("expected the dotlock to be removed")
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("expected only the mbox to remain, but found %d files", len(entries))
+		}
+	}
+}
+
+func TestExpungeIndices(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	// Junk before the first message must survive.
+	original := "\n" + mboxcl
+	err := os.WriteFile(path, []byte(original), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := ExpungeIndices(path, MBOXCL2, []int{0, 2, 7}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("expected to remove 2 messages but removed %d", removed)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := strings.Index(original, "From someone-else\n")
+	third := strings.Index(original, "From nobody\n")
+	CompareBodies("\n"+original[second:third], string(b), t)
+
+	// Removing nothing leaves the file alone.
+	removed, err = ExpungeIndices(path, MBOXCL2, []int{}, &ExpungeOptions{InPlace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("expected to remove nothing but removed %d", removed)
+	}
+
+	_, err = ExpungeIndices(filepath.Join(dir, "missing"), MBOXO, []int{0}, nil)
+	if err == nil {
+		t.Errorf("expected an error for a missing mbox")
+	}
+	err = os.WriteFile(path, []byte(badmboxcl), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ExpungeIndices(path, MBOXCL, []int{0}, nil)
+	if err == nil {
+		t.Errorf("expected an error for a broken mbox")
+	}
+}
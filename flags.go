@@ -0,0 +1,218 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/mail"
+	"sort"
+	"strings"
+)
+
+// Flags describes the state of a message, as mail clients like mutt, pine and
+// UW-IMAP record it in the 'Status' and 'X-Status' headers.
+type Flags uint
+
+const (
+	FlagRead     Flags = 1 << iota // The message has been read ('R' in Status).
+	FlagOld                        // The message is no longer new ('O' in Status).
+	FlagAnswered                   // The message has been answered ('A' in X-Status).
+	FlagFlagged                    // The message has been flagged for attention ('F' in X-Status).
+	FlagDeleted                    // The message has been marked for deletion ('D' in X-Status).
+	FlagDraft                      // The message is a draft ('T' in X-Status).
+)
+
+// statusLetters maps the letters found in the 'Status' header to flags.
+var statusLetters = []struct {
+	letter byte
+	flag   Flags
+}{
+	{'R', FlagRead},
+	{'O', FlagOld},
+}
+
+// xStatusLetters maps the letters found in the 'X-Status' header to flags,
+// in the order UW-IMAP writes them.
+var xStatusLetters = []struct {
+	letter byte
+	flag   Flags
+}{
+	{'D', FlagDeleted},
+	{'F', FlagFlagged},
+	{'A', FlagAnswered},
+	{'T', FlagDraft},
+}
+
+// ParseFlags works out the flags recorded in the 'Status' and 'X-Status'
+// headers.  It ignores letters it doesn't recognize.
+func ParseFlags(header mail.Header) (result Flags) {
+	status := header.Get("Status")
+	for _, l := range statusLetters {
+		if strings.IndexByte(status, l.letter) >= 0 {
+			result |= l.flag
+		}
+	}
+	xStatus := header.Get("X-Status")
+	for _, l := range xStatusLetters {
+		if strings.IndexByte(xStatus, l.letter) >= 0 {
+			result |= l.flag
+		}
+	}
+	return result
+}
+
+// New determines whether the flags describe a new message, one neither read
+// nor seen before.
+func (f Flags) New() bool {
+	return f&(FlagRead|FlagOld) == 0
+}
+
+// Status provides the value of the 'Status' header for the flags.
+func (f Flags) Status() string {
+	result := []byte{}
+	for _, l := range statusLetters {
+		if f&l.flag != 0 {
+			result = append(result, l.letter)
+		}
+	}
+	return string(result)
+}
+
+// XStatus provides the value of the 'X-Status' header for the flags.
+func (f Flags) XStatus() string {
+	result := []byte{}
+	for _, l := range xStatusLetters {
+		if f&l.flag != 0 {
+			result = append(result, l.letter)
+		}
+	}
+	return string(result)
+}
+
+// Flags provides the flags recorded in the message's headers.
+func (msg *Message) Flags() Flags {
+	return ParseFlags(msg.Header)
+}
+
+// flagLines provides the header lines recording the flags, leaving out any
+// header that would be empty.  It adds pad spaces to the end of the last
+// line, which mail readers ignore.
+func flagLines(f Flags, pad int) (result []string) {
+	if status := f.Status(); len(status) > 0 {
+		result = append(result, "Status: "+status)
+	}
+	if xStatus := f.XStatus(); len(xStatus) > 0 {
+		result = append(result, "X-Status: "+xStatus)
+	}
+	if len(result) > 0 && pad > 0 {
+		result[len(result)-1] += strings.Repeat(" ", pad)
+	}
+	return result
+}
+
+// withFlags replaces the 'Status' and 'X-Status' headers in raw with ones
+// recording the flags, adding pad spaces as flagLines does.
+func withFlags(raw []byte, f Flags, pad int) []byte {
+	return rewriteHeader(raw, dropHeaders("Status", "X-Status"), flagLines(f, pad))
+}
+
+// headerUpdate describes a header rewritten by SetFlags.
+type headerUpdate struct {
+	start  int64  // The offset of the original header within the mbox.
+	size   int64  // The size of the original header.
+	header []byte // The new header.
+	padded []byte // The new header, padded to the size of the original, or nil if that isn't possible.
+}
+
+// SetFlags records new flags for messages in the mbox at path, replacing their
+// 'Status' and 'X-Status' headers.  The flags map holds the new flags for each
+// message, keyed by the message's position within the mbox.  If lock isn't
+// nil, SetFlags holds the described locks while working.
+//
+// When the new headers fit in the space taken by the old ones, SetFlags
+// overwrites just those headers within the file, padding them with spaces as
+// needed.  Otherwise, it rewrites the mbox through a temporary file, as
+// Expunge does.  It never touches a message's body, so the Content-Length of
+// MBOXCL and MBOXCL2 messages remains correct.
+func SetFlags(path string, mboxType int, flags map[int]Flags, lock *LockOptions) (err error) {
+	file, closer, err := openMailbox(path, lock)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	idx, err := indexFile(file, mboxType)
+	if err != nil {
+		return err
+	}
+
+	positions := []int{}
+	for n := range flags {
+		if n < 0 || n >= len(idx.Entries) {
+			return fmt.Errorf("message %d out of range", n)
+		}
+		positions = append(positions, n)
+	}
+	sort.Ints(positions)
+
+	updates := []headerUpdate{}
+	inPlace := true
+	for _, n := range positions {
+		entry := idx.Entries[n]
+		raw := make([]byte, entry.HeaderEnd-entry.From)
+		_, err = file.ReadAt(raw, entry.From)
+		if err != nil {
+			return err
+		}
+		// Leave the 'From ' line alone.
+		skip := bytes.IndexByte(raw, '\n') + 1
+		header := raw[skip:]
+		update := headerUpdate{
+			start:  entry.From + int64(skip),
+			size:   int64(len(header)),
+			header: withFlags(header, flags[n], 0),
+		}
+		pad := len(header) - len(update.header)
+		if pad == 0 {
+			update.padded = update.header
+		} else if pad > 0 {
+			padded := withFlags(header, flags[n], pad)
+			if len(padded) == len(header) {
+				update.padded = padded
+			}
+		}
+		if update.padded == nil {
+			inPlace = false
+		}
+		updates = append(updates, update)
+	}
+
+	if inPlace {
+		for _, update := range updates {
+			_, err = file.WriteAt(update.padded, update.start)
+			if err != nil {
+				return err
+			}
+		}
+		return file.Sync()
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return replaceMailbox(path, file, func(dst io.Writer) error {
+		pos := int64(0)
+		for _, update := range updates {
+			_, err := io.Copy(dst, io.NewSectionReader(file, pos, update.start-pos))
+			if err != nil {
+				return err
+			}
+			_, err = dst.Write(update.header)
+			if err != nil {
+				return err
+			}
+			pos = update.start + update.size
+		}
+		_, err := io.Copy(dst, io.NewSectionReader(file, pos, info.Size()-pos))
+		return err
+	})
+}
@@ -0,0 +1,140 @@
+package mbox
+
+import (
+	"bytes"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var flaggedMboxcl string = `From someone
+From: bubbles@bubbletown.com
+Status: RO
+X-Status: F
+Subject: To interpretation
+Content-Length: 42
+
+>From all of us, to all of you, be happy!
+From someone-else
+From: mrspam@corporate.corp.com
+Subject: Bestest offer in the universe!!11!!
+Content-Length: 32
+
+You won't believe these prices!
+`
+
+func TestParseFlags(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader("Status: RO\nX-Status: AFT\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := ParseFlags(msg.Header)
+	expected := FlagRead | FlagOld | FlagAnswered | FlagFlagged | FlagDraft
+	if f != expected {
+		t.Errorf("expected %b but got %b", expected, f)
+	}
+	if f.New() {
+		t.Errorf("expected the message not to be new")
+	}
+	if f.Status() != "RO" {
+		t.Errorf("expected RO but got %s", f.Status())
+	}
+	if f.XStatus() != "FAT" {
+		t.Errorf("expected FAT but got %s", f.XStatus())
+	}
+	if !Flags(0).New() {
+		t.Errorf("expected no flags to mean new")
+	}
+	if (FlagDeleted).XStatus() != "D" {
+		t.Errorf("expected D but got %s", FlagDeleted.XStatus())
+	}
+}
+
+func TestMessageFlags(t *testing.T) {
+	box := NewReader(bytes.NewBufferString(flaggedMboxcl))
+	box.Type = MBOXCL
+	if !box.Next() {
+		t.Fatal(box.Err())
+	}
+	f := box.Message().Flags()
+	if f != FlagRead|FlagOld|FlagFlagged {
+		t.Errorf("unexpected flags %b", f)
+	}
+	if !box.Next() {
+		t.Fatal(box.Err())
+	}
+	if !box.Message().Flags().New() {
+		t.Errorf("expected the second message to be new")
+	}
+}
+
+func TestSetFlagsInPlace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(flaggedMboxcl), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shrinking the flags fits in place.
+	err = SetFlags(path, MBOXCL, map[int]Flags{0: FlagOld}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != len(flaggedMboxcl) {
+		t.Errorf("expected the size to remain %d but got %d", len(flaggedMboxcl), len(b))
+	}
+	expected := strings.Replace(flaggedMboxcl, "Status: RO\nX-Status: F\n", "", 1)
+	expected = strings.Replace(expected, "Content-Length: 42\n", "Content-Length: 42\nStatus: O"+strings.Repeat(" ", 13)+"\n", 1)
+	CompareBodies(expected, string(b), t)
+
+	box := NewReader(bytes.NewReader(b))
+	box.Type = MBOXCL
+	count := 0
+	for box.Next() {
+		count++
+	}
+	if box.Err() != nil || count != 2 {
+		t.Errorf("expected 2 messages but got %d (%v)", count, box.Err())
+	}
+}
+
+func TestSetFlagsRewrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(flaggedMboxcl), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second message has no room, so this needs a rewrite.
+	err = SetFlags(path, MBOXCL, map[int]Flags{0: FlagRead | FlagOld, 1: FlagRead | FlagOld | FlagAnswered}, &LockOptions{Methods: []LockMethod{LockDotlock}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(flaggedMboxcl, "Status: RO\nX-Status: F\n", "", 1)
+	expected = strings.Replace(expected, "Content-Length: 42\n", "Content-Length: 42\nStatus: RO\n", 1)
+	expected = strings.Replace(expected, "Content-Length: 32\n", "Content-Length: 32\nStatus: RO\nX-Status: A\n", 1)
+	CompareBodies(expected, string(b), t)
+
+	box := NewReader(bytes.NewReader(b))
+	box.Type = MBOXCL
+	box.Next()
+	box.Next()
+	if box.Message().Flags() != FlagRead|FlagOld|FlagAnswered {
+		t.Errorf("unexpected flags %b", box.Message().Flags())
+	}
+
+	err = SetFlags(path, MBOXCL, map[int]Flags{2: FlagRead}, nil)
+	if err == nil {
+		t.Errorf("expected an error for a message out of range")
+	}
+}
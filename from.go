@@ -2,6 +2,7 @@ package mbox
 
 import (
 	"fmt"
+	"net/mail"
 	"strings"
 	"time"
 )
@@ -10,9 +11,35 @@ import (
 // One may use this with time.Format and time.Parse functions.
 var TimeFormat string = "Mon Jan  2 15:04:05 2006"
 
+// fromTimeFormats lists other ways of formatting the date/time seen on 'From '
+// lines in the wild, which ParseFrom tries when TimeFormat doesn't fit.
+var fromTimeFormats = []string{
+	"Mon Jan _2 15:04:05 -0700 2006", // Gmail Takeout, among others.
+}
+
+// zoneOffsets maps the time zone names RFC 822 allows to their offsets.
+// time.Parse accepts any name but, unless it happens to name the local zone,
+// treats it as UTC, so ParseFrom swaps known names for their offsets first
+// and refuses the rest.
+var zoneOffsets = map[string]string{
+	"UT":  "+0000",
+	"UTC": "+0000",
+	"GMT": "+0000",
+	"EST": "-0500",
+	"EDT": "-0400",
+	"CST": "-0600",
+	"CDT": "-0500",
+	"MST": "-0700",
+	"MDT": "-0600",
+	"PST": "-0800",
+	"PDT": "-0700",
+}
+
 // ParseFrom parses a from string to its component parts.
 // It helpfully translates the date/time to a time.Time.  A mailer might use
-// this information in some way, if needed.
+// this information in some way, if needed.  Besides TimeFormat, it
+// understands dates carrying a time zone before the year, as found in Gmail
+// Takeout exports.
 func ParseFrom(from string) (addr string, date time.Time, moreinfo string, err error) {
 	data, _ := strings.CutPrefix(from, "From ")
 	addr, remainder, _ := strings.Cut(data, " ")
@@ -20,12 +47,70 @@ func ParseFrom(from string) (addr string, date time.Time, moreinfo string, err e
 		date, err = time.Parse(TimeFormat, strings.TrimSpace(remainder[:len(TimeFormat)]))
 		moreinfo = remainder[len(TimeFormat):]
 	}
+	if err != nil {
+		for _, layout := range fromTimeFormats {
+			text, rest, ok := cutFields(remainder, len(strings.Fields(layout)))
+			if !ok {
+				continue
+			}
+			d, e := time.Parse(layout, numericZone(text))
+			if e == nil {
+				return addr, d, strings.TrimSpace(rest), nil
+			}
+		}
+	}
 
 	return addr, date, strings.TrimSpace(moreinfo), err
 }
 
+// cutFields splits text after its first count space-separated fields,
+// returning those fields separated by single spaces, and whatever follows.
+func cutFields(text string, count int) (fields string, rest string, ok bool) {
+	found := []string{}
+	rest = text
+	for len(found) < count {
+		rest = strings.TrimLeft(rest, " ")
+		if len(rest) == 0 {
+			return "", "", false
+		}
+		field, remainder, _ := strings.Cut(rest, " ")
+		found = append(found, field)
+		rest = remainder
+	}
+	return strings.Join(found, " "), rest, true
+}
+
+// numericZone replaces a time zone name in the fifth field of text, where
+// fromTimeFormats expect the zone, with its offset from zoneOffsets.
+func numericZone(text string) string {
+	fields := strings.Split(text, " ")
+	if len(fields) < 5 {
+		return text
+	}
+	if offset, ok := zoneOffsets[strings.ToUpper(fields[4])]; ok {
+		fields[4] = offset
+	}
+	return strings.Join(fields, " ")
+}
+
 // BuildFrom creates a from string based on the provided data.
 // A mailer might build this to add to an mbox that it creates.
 func BuildFrom(addr string, date time.Time, moreinfo string) (result string) {
 	return fmt.Sprintf("From %s %s %s", addr, date.Format(TimeFormat), moreinfo)
 }
+
+// senderFrom builds a 'From ' line for a message lacking one, taking the
+// address from its 'Return-Path' header (or its 'From' header, failing that)
+// and the date from the time of delivery.
+func senderFrom(header mail.Header, delivered time.Time) string {
+	addr := ""
+	if list, err := mail.ParseAddressList(header.Get("Return-Path")); err == nil && len(list) > 0 {
+		addr = list[0].Address
+	} else if list, err := mail.ParseAddressList(header.Get("From")); err == nil && len(list) > 0 {
+		addr = list[0].Address
+	}
+	if len(addr) == 0 {
+		addr = "MAILER-DAEMON"
+	}
+	return strings.TrimSpace(BuildFrom(addr, delivered.UTC(), ""))
+}
@@ -49,3 +49,53 @@ func TestBuildFrom(t *testing.T) {
 		t.Errorf("expected [%s] but got [%s]", expectedFrom, from)
 	}
 }
+
+func TestParseFromTakeout(t *testing.T) {
+	from := "From 1590000000000000000@xxx Wed Feb  5 18:03:53 +0000 2020"
+	addr, date, moreinfo, err := ParseFrom(from)
+	if err != nil {
+		t.Errorf("expected success but it failed: %s", err)
+	}
+	expectedAddr := "1590000000000000000@xxx"
+	if addr != expectedAddr {
+		t.Errorf("expected %s but got %s", expectedAddr, addr)
+	}
+	expectedTime := time.Date(2020, time.February, 5, 18, 3, 53, 0, time.UTC)
+	if !expectedTime.Equal(date) {
+		t.Errorf("expected %s but got %s", expectedTime.String(), date.String())
+	}
+	if moreinfo != "" {
+		t.Errorf("expected no moreinfo but got %s", moreinfo)
+	}
+
+	_, date, moreinfo, err = ParseFrom("From someone Wed Feb 19 18:03:53 UTC 2020 remote from nowhere")
+	if err != nil {
+		t.Errorf("expected success but it failed: %s", err)
+	}
+	expectedTime = time.Date(2020, time.February, 19, 18, 3, 53, 0, time.UTC)
+	if !expectedTime.Equal(date) {
+		t.Errorf("expected %s but got %s", expectedTime.String(), date.String())
+	}
+	if moreinfo != "remote from nowhere" {
+		t.Errorf("expected 'remote from nowhere' but got %s", moreinfo)
+	}
+
+	// Named zones keep their offsets rather than passing for UTC.
+	_, date, _, err = ParseFrom("From someone Wed Feb 19 18:03:53 EST 2020")
+	if err != nil {
+		t.Errorf("expected success but it failed: %s", err)
+	}
+	expectedTime = time.Date(2020, time.February, 19, 23, 3, 53, 0, time.UTC)
+	if !expectedTime.Equal(date) {
+		t.Errorf("expected %s but got %s", expectedTime.String(), date.String())
+	}
+	_, _, _, err = ParseFrom("From someone Wed Feb 19 18:03:53 XYZ 2020")
+	if err == nil {
+		t.Errorf("expected an unknown zone to fail, but it worked")
+	}
+
+	_, _, _, err = ParseFrom("From someone sometime in the last century, or so")
+	if err == nil {
+		t.Errorf("expected an error, but it worked")
+	}
+}
@@ -2,4 +2,9 @@ module github.com/tvanriper/mbox
 
 go 1.20
 
-require github.com/kylelemons/godebug v1.1.0
+require (
+	github.com/dsnet/compress v0.0.1
+	github.com/klauspost/compress v1.17.4
+	github.com/kylelemons/godebug v1.1.0
+	github.com/ulikunitz/xz v0.5.12
+)
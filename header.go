@@ -0,0 +1,117 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// headerName provides the name of the header on the given line, or an empty
+// string if the line doesn't start a header.
+func headerName(line []byte) string {
+	if len(line) == 0 || line[0] == ' ' || line[0] == '\t' {
+		return ""
+	}
+	name, _, found := strings.Cut(string(line), ":")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
+
+// isBlankLine determines whether the line ends a header, allowing for either
+// kind of line ending.
+func isBlankLine(line []byte) bool {
+	return len(line) == 0 || string(line) == "\n" || string(line) == "\r\n"
+}
+
+// lineEnding provides the line ending used by the first line in raw,
+// defaulting to "\n".
+func lineEnding(raw []byte) string {
+	i := bytes.IndexByte(raw, '\n')
+	if i > 0 && raw[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// rewriteHeader removes the header lines in raw whose names drop matches,
+// along with their continuation lines, then adds the given lines just before
+// the blank line ending the header.  The raw bytes hold a message's header,
+// optionally followed by the blank line and the body, which it leaves alone.
+// Added lines use the same line ending as the first line in raw.
+func rewriteHeader(raw []byte, drop func(name string) bool, add []string) []byte {
+	eol := lineEnding(raw)
+	result := bytes.NewBuffer(make([]byte, 0, len(raw)+64))
+	dropping := false
+	rest := raw
+	for len(rest) > 0 {
+		var line []byte
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			line, rest = rest, nil
+		} else {
+			line, rest = rest[:i+1], rest[i+1:]
+		}
+		if isBlankLine(line) {
+			// The header is done; the rest belongs to the body.
+			for _, a := range add {
+				result.WriteString(a + eol)
+			}
+			result.Write(line)
+			result.Write(rest)
+			return result.Bytes()
+		}
+		name := headerName(line)
+		if len(name) > 0 {
+			dropping = drop(name)
+		}
+		if !dropping {
+			result.Write(line)
+		}
+	}
+	// The header had no blank line after it.
+	if result.Len() > 0 && !bytes.HasSuffix(result.Bytes(), []byte("\n")) {
+		result.WriteString(eol)
+	}
+	for _, a := range add {
+		result.WriteString(a + eol)
+	}
+	return result.Bytes()
+}
+
+// dropHeaders provides a function for rewriteHeader that drops the headers
+// with the given names, ignoring case.
+func dropHeaders(names ...string) func(string) bool {
+	return func(name string) bool {
+		for _, n := range names {
+			if strings.EqualFold(n, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// rewriteMailHeader works like rewriteHeader, but on a stream holding a whole
+// message.  It reads only the header into memory, leaving the body to stream
+// through untouched.
+func rewriteMailHeader(mail io.Reader, drop func(name string) bool, add []string) (result io.Reader, err error) {
+	reader := bufio.NewReader(mail)
+	header := bytes.NewBuffer([]byte{})
+	for {
+		b, err := reader.ReadBytes('\n')
+		header.Write(b)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isBlankLine(b) {
+			break
+		}
+	}
+	return io.MultiReader(bytes.NewReader(rewriteHeader(header.Bytes(), drop, add)), reader), nil
+}
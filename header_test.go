@@ -0,0 +1,19 @@
+package mbox
+
+import "testing"
+
+func TestRewriteHeader(t *testing.T) {
+	raw := "From: bubbles@bubbletown.com\nStatus: O\nX-Status: F\n  continued\nSubject: Hello\n\nStatus: in the body\n"
+	result := rewriteHeader([]byte(raw), dropHeaders("status", "x-status"), []string{"Status: RO"})
+	CompareBodies("From: bubbles@bubbletown.com\nSubject: Hello\nStatus: RO\n\nStatus: in the body\n", string(result), t)
+
+	// Without a blank line, the new lines go at the end.
+	raw = "From: bubbles@bubbletown.com\nStatus: O"
+	result = rewriteHeader([]byte(raw), dropHeaders("Status"), []string{"Status: R"})
+	CompareBodies("From: bubbles@bubbletown.com\nStatus: R\n", string(result), t)
+
+	// New lines follow the line ending already in use.
+	raw = "From: bubbles@bubbletown.com\r\n\r\nHi.\r\n"
+	result = rewriteHeader([]byte(raw), dropHeaders("Status"), []string{"Status: R"})
+	CompareBodies("From: bubbles@bubbletown.com\r\nStatus: R\r\n\r\nHi.\r\n", string(result), t)
+}
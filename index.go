@@ -0,0 +1,113 @@
+package mbox
+
+import (
+	"fmt"
+	"io"
+)
+
+// IndexEntry records where a single message lives within an mbox.
+type IndexEntry struct {
+	From      int64 // The offset of the message's 'From ' line.
+	HeaderEnd int64 // The offset just past the blank line ending the header, where the body begins.
+	BodyEnd   int64 // The offset just past the message's body, where the next 'From ' line begins.
+}
+
+// Index holds the byte offsets of every message within an mbox, allowing one
+// to jump straight to a message without reading the ones before it.
+type Index struct {
+	Type    int          // The type of mbox indexed.
+	Entries []IndexEntry // One entry per message, in the order they appear.
+}
+
+// RandomReader reads individual messages from an mbox using an Index.
+// Use NewRandomReader to instantiate.
+type RandomReader struct {
+	Index *Index // The index describing the mbox.
+	read  io.ReaderAt
+}
+
+// BuildIndex scans the mbox in reader once, recording the offsets of each
+// message it finds.  The mboxType describes how to parse the mbox, just as
+// with MboxReader.Type.  If you have an io.ReaderAt, wrap it with
+// io.NewSectionReader to index it.
+func BuildIndex(reader io.Reader, mboxType int) (result *Index, err error) {
+	entries, err := scanIndex(reader, 0, mboxType)
+	if err != nil {
+		return nil, err
+	}
+	return &Index{Type: mboxType, Entries: entries}, nil
+}
+
+// scanIndex reads reader with an MboxReader, recording the offsets of each
+// message found.  The base gets added to every offset, for when reader starts
+// partway into the mbox.
+func scanIndex(reader io.Reader, base int64, mboxType int) (entries []IndexEntry, err error) {
+	box := NewReader(reader)
+	box.Type = mboxType
+	entries = []IndexEntry{}
+	for {
+		from, err := box.NextMessage(io.Discard)
+		if err != nil && err != io.EOF {
+			return entries, err
+		}
+		if len(from) == 0 {
+			// No 'From ' line means there was no message.
+			return entries, nil
+		}
+		entry := IndexEntry{
+			From:      base + box.start,
+			HeaderEnd: base + box.headerEnd,
+			BodyEnd:   base + box.end,
+		}
+		if box.headerEnd < 0 {
+			// The message has no body.
+			entry.HeaderEnd = entry.BodyEnd
+		}
+		entries = append(entries, entry)
+		if err == io.EOF {
+			return entries, nil
+		}
+	}
+}
+
+// Len returns the number of messages in the index.
+func (idx *Index) Len() int {
+	return len(idx.Entries)
+}
+
+// NewRandomReader creates a RandomReader for the mbox in read, as described by
+// index.
+func NewRandomReader(read io.ReaderAt, index *Index) *RandomReader {
+	return &RandomReader{Index: index, read: read}
+}
+
+// Section provides the raw bytes of message n, exactly as they appear in the
+// mbox, including the 'From ' line.
+func (r *RandomReader) Section(n int) (result *io.SectionReader, err error) {
+	if n < 0 || n >= len(r.Index.Entries) {
+		return nil, fmt.Errorf("message %d out of range", n)
+	}
+	entry := r.Index.Entries[n]
+	return io.NewSectionReader(r.read, entry.From, entry.BodyEnd-entry.From), nil
+}
+
+// Message reads message n from the mbox, un-escaping it the same way
+// MboxReader.NextMessage would.  The resulting message's Offset describes its
+// place within the whole mbox.
+func (r *RandomReader) Message(n int) (msg *Message, err error) {
+	section, err := r.Section(n)
+	if err != nil {
+		return nil, err
+	}
+	box := NewReader(section)
+	box.Type = r.Index.Type
+	if !box.Next() {
+		if box.Err() != nil {
+			return nil, box.Err()
+		}
+		return nil, fmt.Errorf("no message found at index %d", n)
+	}
+	msg = box.Message()
+	msg.Offset += r.Index.Entries[n].From
+	return msg, nil
+}
@@ -0,0 +1,120 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// expectedEntries works out the index entries for an mbox by looking for the
+// given 'From ' lines and the blank line following each.
+func expectedEntries(mb string, froms []string) (entries []IndexEntry) {
+	for i, from := range froms {
+		start := int64(strings.Index(mb, from+"\n"))
+		end := int64(len(mb))
+		if i+1 < len(froms) {
+			end = int64(strings.Index(mb, froms[i+1]+"\n"))
+		}
+		headerEnd := start + int64(strings.Index(mb[start:], "\n\n")) + 2
+		if headerEnd > end {
+			headerEnd = end
+		}
+		entries = append(entries, IndexEntry{From: start, HeaderEnd: headerEnd, BodyEnd: end})
+	}
+	return entries
+}
+
+func TestBuildIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		mb    string
+		mType int
+		froms []string
+	}{
+		{"MBOXO", mboxo, MBOXO, []string{"From someone", "From someone-else"}},
+		{"MBOXRD", mboxo, MBOXRD, []string{"From someone", "From someone-else"}},
+		{"MBOXCL", mboxcl, MBOXCL, []string{"From someone", "From someone-else", "From nobody"}},
+		{"MBOXCL2", mboxcl, MBOXCL2, []string{"From someone", "From someone-else", "From nobody"}},
+	}
+	for _, test := range tests {
+		idx, err := BuildIndex(strings.NewReader(test.mb), test.mType)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		expected := expectedEntries(test.mb, test.froms)
+		if idx.Len() != len(expected) {
+			t.Errorf("%s: expected %d entries but got %d", test.name, len(expected), idx.Len())
+			continue
+		}
+		for i, entry := range idx.Entries {
+			if entry != expected[i] {
+				t.Errorf("%s: entry %d expected %+v but got %+v", test.name, i, expected[i], entry)
+			}
+		}
+	}
+}
+
+func TestBuildIndexError(t *testing.T) {
+	_, err := BuildIndex(strings.NewReader(badmboxcl), MBOXCL)
+	if err == nil {
+		t.Errorf("expected an error, but it worked")
+	}
+}
+
+func TestRandomReader(t *testing.T) {
+	file := bytes.NewReader([]byte(mboxcl))
+	idx, err := BuildIndex(io.NewSectionReader(file, 0, file.Size()), MBOXCL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := NewRandomReader(file, idx)
+
+	msg, err := random.Message(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.From != "From someone-else" {
+		t.Errorf("expected From someone-else but got %s", msg.From)
+	}
+	if msg.Offset != idx.Entries[1].From {
+		t.Errorf("expected offset %d but got %d", idx.Entries[1].From, msg.Offset)
+	}
+	b, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	// The random reader must un-escape the body just as MboxReader does.
+	CompareBodies(`You won't believe these prices!
+From 1 cent to 11 cents, we carry the least expensive
+line of jets this side of the Gobi Desert!
+`, string(b), t)
+
+	msg, err = random.Message(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Subject") != "Mysterious Jenkins" {
+		t.Errorf("unexpected subject %s", msg.Header.Get("Subject"))
+	}
+
+	section, err := random.Section(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(section)
+	if err != nil {
+		t.Error(err)
+	}
+	CompareBodies(mboxcl[:idx.Entries[0].BodyEnd], string(b), t)
+
+	_, err = random.Message(3)
+	if err == nil {
+		t.Errorf("expected an error for a message out of range")
+	}
+	_, err = random.Message(-1)
+	if err == nil {
+		t.Errorf("expected an error for a negative message")
+	}
+}
@@ -0,0 +1,96 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// newline provides the line ending described by ending, or fallback when
+// preserving line endings.
+func newline(ending int, fallback string) string {
+	switch ending {
+	case LFLineEnding:
+		return "\n"
+	case CRLFLineEnding:
+		return "\r\n"
+	}
+	return fallback
+}
+
+// convertLineEnding gives line, which ends with at most one line ending, the
+// line ending described by ending.  A final line lacking a line ending stays
+// that way.
+func convertLineEnding(line []byte, ending int) []byte {
+	if ending == PreserveLineEnding || !bytes.HasSuffix(line, []byte("\n")) {
+		return line
+	}
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+	return append(line, newline(ending, "")...)
+}
+
+// lineEndingReader converts the line endings of the stream it reads.
+type lineEndingReader struct {
+	read   *bufio.Reader
+	ending int
+	line   []byte // What remains of the converted line.
+}
+
+// Read reads the converted stream into p.
+func (r *lineEndingReader) Read(p []byte) (n int, err error) {
+	if len(r.line) == 0 {
+		r.line, err = r.read.ReadBytes('\n')
+		r.line = convertLineEnding(r.line, r.ending)
+		if len(r.line) == 0 {
+			return 0, err
+		}
+	}
+	n = copy(p, r.line)
+	r.line = r.line[n:]
+	return n, nil
+}
+
+// lineEndingWriter converts the line endings of the stream it writes.  Call
+// flush when done.
+type lineEndingWriter struct {
+	write  io.Writer
+	ending int
+	cr     bool // Whether the last byte given was '\r', which LFLineEnding holds back until it sees the next.
+}
+
+// Write writes p to the underlying writer, converting its line endings.
+func (w *lineEndingWriter) Write(p []byte) (n int, err error) {
+	out := make([]byte, 0, len(p)+len(p)/16)
+	for _, c := range p {
+		switch w.ending {
+		case LFLineEnding:
+			if w.cr && c != '\n' {
+				out = append(out, '\r')
+			}
+			w.cr = c == '\r'
+			if !w.cr {
+				out = append(out, c)
+			}
+		default:
+			if c == '\n' && !w.cr {
+				out = append(out, '\r')
+			}
+			w.cr = c == '\r'
+			out = append(out, c)
+		}
+	}
+	_, err = w.write.Write(out)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush writes any '\r' held back at the end of the stream.
+func (w *lineEndingWriter) flush() (err error) {
+	if w.ending == LFLineEnding && w.cr {
+		w.cr = false
+		_, err = w.write.Write([]byte{'\r'})
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestConvertLineEnding(t *testing.T) {
+	tests := []struct {
+		line     string
+		ending   int
+		expected string
+	}{
+		{"abc\r\n", PreserveLineEnding, "abc\r\n"},
+		{"abc\r\n", LFLineEnding, "abc\n"},
+		{"abc\n", CRLFLineEnding, "abc\r\n"},
+		{"abc\r\n", CRLFLineEnding, "abc\r\n"},
+		{"abc", CRLFLineEnding, "abc"},
+		{"a\rc\n", LFLineEnding, "a\rc\n"},
+	}
+	for _, test := range tests {
+		found := string(convertLineEnding([]byte(test.line), test.ending))
+		if found != test.expected {
+			t.Errorf("expected %q from %q but got %q", test.expected, test.line, found)
+		}
+	}
+}
+
+func TestLineEndingWriter(t *testing.T) {
+	result := bytes.NewBuffer([]byte{})
+	w := &lineEndingWriter{write: result, ending: LFLineEnding}
+	// The '\r' ending one write belongs with the '\n' starting the next.
+	for _, part := range []string{"one\r", "\ntwo\r\n\r", "x\r"} {
+		_, err := w.Write([]byte(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareBodies("one\ntwo\n\rx\r", result.String(), t)
+
+	result.Reset()
+	w = &lineEndingWriter{write: result, ending: CRLFLineEnding}
+	for _, part := range []string{"one\r", "\ntwo\n", "\n"} {
+		_, err := w.Write([]byte(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	CompareBodies("one\r\ntwo\r\n\r\n", result.String(), t)
+}
+
+func TestReadLineEnding(t *testing.T) {
+	original := "From a@b Mon Jan  1 00:00:00 2024\r\nSubject: one\r\nContent-Length: 15\r\n\r\n>From the top\r\n"
+	box := NewReader(bytes.NewBufferString(original))
+	box.Type = MBOXCL
+	box.LineEnding = LFLineEnding
+	msg := bytes.NewBuffer([]byte{})
+	from, err := box.NextMessage(msg)
+	if err != io.EOF {
+		t.Errorf("expected EOF but got %v", err)
+	}
+	if from != "From a@b Mon Jan  1 00:00:00 2024" {
+		t.Errorf("unexpected from %q", from)
+	}
+	CompareBodies("Subject: one\nContent-Length: 15\n\nFrom the top\n", msg.String(), t)
+}
+
+func TestWriteLineEnding(t *testing.T) {
+	mail := "Subject: one\n\nFrom the top\nmore"
+	tests := []struct {
+		name     string
+		mboxType int
+		ending   int
+		mail     string
+		expected string
+	}{
+		{"mboxo crlf", MBOXO, CRLFLineEnding, mail,
+			"From a@b\r\nSubject: one\r\n\r\n>From the top\r\nmore\r\n\r\n"},
+		{"mboxrd preserve", MBOXRD, PreserveLineEnding, "Subject: one\r\n\r\nbody\r\n",
+			"From a@b\r\nSubject: one\r\n\r\nbody\r\n\r\n"},
+		{"mboxcl crlf", MBOXCL, CRLFLineEnding, mail,
+			"From a@b\r\nSubject: one\r\nContent-Length: 21\r\n\r\n>From the top\r\nmore\r\n"},
+		{"mboxcl2 lf", MBOXCL2, LFLineEnding, "Subject: one\r\n\r\nFrom the top\r\n",
+			"From a@b\nSubject: one\nContent-Length: 13\n\nFrom the top\n"},
+		{"mboxcl2 preserve", MBOXCL2, PreserveLineEnding, "Subject: one\r\n\r\nbody\r\n",
+			"From a@b\r\nSubject: one\r\nContent-Length: 6\r\n\r\nbody\r\n"},
+		{"mboxcl2 existing length crlf", MBOXCL2, CRLFLineEnding, "Content-Length: 8\nSubject: one\n\nbody\nmore\n",
+			"From a@b\r\nSubject: one\r\nContent-Length: 12\r\n\r\nbody\r\nmore\r\n"},
+		{"mmdf crlf", MMDF, CRLFLineEnding, mail,
+			"\x01\x01\x01\x01\r\nFrom a@b\r\nSubject: one\r\n\r\nFrom the top\r\nmore\r\n\x01\x01\x01\x01\r\n"},
+	}
+	for _, test := range tests {
+		result := bytes.NewBuffer([]byte{})
+		writer := NewWriter(result)
+		writer.Type = test.mboxType
+		writer.LineEnding = test.ending
+		err := writer.WriteMail("From a@b\r", bytes.NewBufferString(test.mail))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if result.String() != test.expected {
+			t.Errorf("%s: expected %q but got %q", test.name, test.expected, result.String())
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package mbox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockMethod describes a way of locking an mbox file.
+type LockMethod int
+
+const (
+	LockDotlock LockMethod = iota // Creates a 'mbox.lock' file beside the mbox, as procmail and most MTAs do.
+	LockFlock                     // Uses flock(2) on the mbox file.
+	LockFcntl                     // Uses an fcntl(2) record lock on the mbox file.
+)
+
+// String provides the name of the lock method.
+func (l LockMethod) String() string {
+	switch l {
+	case LockDotlock:
+		return "dotlock"
+	case LockFlock:
+		return "flock"
+	case LockFcntl:
+		return "fcntl"
+	}
+	return fmt.Sprintf("LockMethod(%d)", int(l))
+}
+
+// LockOptions describes how OpenLocked locks an mbox.  The zero value of each
+// field selects a reasonable default.
+type LockOptions struct {
+	Methods    []LockMethod  // The lock methods to use, in the order to acquire them.  Defaults to dotlock, then fcntl on Linux, or just dotlock elsewhere.
+	Timeout    time.Duration // How long to keep trying to acquire the locks.  Defaults to 30 seconds.
+	Retry      time.Duration // How long to wait between attempts.  Defaults to 100 milliseconds.
+	StaleAfter time.Duration // How old a dotlock may get before it is considered abandoned, when it doesn't name a process we can check on.  Defaults to 5 minutes.
+}
+
+// LockedMailbox holds an open mbox file along with the locks protecting it.
+// Use OpenLocked to instantiate, and Close to release the locks.
+type LockedMailbox struct {
+	File     *os.File     // The open mbox file.
+	Path     string       // The path to the mbox file.
+	held     []LockMethod // The locks acquired, in the order acquired.
+	dotlock  string       // The path to the dotlock file.
+	readOnly bool         // Whether the file was opened only for reading, which calls for shared locks.
+}
+
+// errLockBusy reports that another process holds a lock.
+var errLockBusy = fmt.Errorf("lock is held by another process")
+
+// defaultLockOptions fills in the defaults for any option left unset.
+func defaultLockOptions(opts *LockOptions) LockOptions {
+	result := LockOptions{}
+	if opts != nil {
+		result = *opts
+	}
+	if len(result.Methods) == 0 {
+		result.Methods = defaultLockMethods
+	}
+	if result.Timeout <= 0 {
+		result.Timeout = 30 * time.Second
+	}
+	if result.Retry <= 0 {
+		result.Retry = 100 * time.Millisecond
+	}
+	if result.StaleAfter <= 0 {
+		result.StaleAfter = 5 * time.Minute
+	}
+	return result
+}
+
+// OpenLocked opens the mbox at path with os.OpenFile, using flag and perm,
+// then acquires each of the locks described in opts, in order.  If opts is
+// nil, it uses the defaults described by LockOptions.  Files opened only for
+// reading receive shared flock and fcntl locks; otherwise the locks are
+// exclusive.
+//
+// Dotlocks require permission to create files in the directory holding the
+// mbox.  The flock and fcntl methods are only available on Linux.
+func OpenLocked(path string, flag int, perm os.FileMode, opts *LockOptions) (result *LockedMailbox, err error) {
+	options := defaultLockOptions(opts)
+	file, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	result = &LockedMailbox{
+		File:     file,
+		Path:     path,
+		dotlock:  path + ".lock",
+		readOnly: flag&(os.O_WRONLY|os.O_RDWR) == 0,
+	}
+	deadline := time.Now().Add(options.Timeout)
+	for _, method := range options.Methods {
+		for {
+			err = result.tryLock(method, options.StaleAfter)
+			if err == nil {
+				result.held = append(result.held, method)
+				break
+			}
+			if err != errLockBusy || time.Now().After(deadline) {
+				result.Close()
+				return nil, fmt.Errorf("unable to acquire %s lock on %s: %s", method, path, err)
+			}
+			time.Sleep(options.Retry)
+		}
+	}
+	return result, nil
+}
+
+// tryLock attempts to acquire the lock once, returning errLockBusy if
+// another process holds it.
+func (l *LockedMailbox) tryLock(method LockMethod, staleAfter time.Duration) (err error) {
+	switch method {
+	case LockDotlock:
+		return tryDotlock(l.dotlock, staleAfter)
+	case LockFlock:
+		return flockFile(l.File, !l.readOnly)
+	case LockFcntl:
+		return fcntlLockFile(l.File, !l.readOnly)
+	}
+	return fmt.Errorf("unknown lock method %d", int(method))
+}
+
+// unlock releases a lock acquired by tryLock.
+func (l *LockedMailbox) unlock(method LockMethod) (err error) {
+	switch method {
+	case LockDotlock:
+		return removeDotlock(l.dotlock)
+	case LockFlock:
+		return funlockFile(l.File)
+	case LockFcntl:
+		return fcntlUnlockFile(l.File)
+	}
+	return fmt.Errorf("unknown lock method %d", int(method))
+}
+
+// tryDotlock creates the dotlock file, holding our process ID.  If the file
+// exists, but is older than staleAfter or names a process that no longer
+// exists, it takes the file out of the way and tries again.
+func tryDotlock(lockPath string, staleAfter time.Duration) (err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var file *os.File
+		file, err = os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+			closeErr := file.Close()
+			if err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+			}
+			return err
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		stale := dotlockStale(lockPath, staleAfter)
+		if stale == nil {
+			return errLockBusy
+		}
+		err = removeStaleDotlock(lockPath, stale)
+		if err != nil {
+			return err
+		}
+	}
+	return errLockBusy
+}
+
+// removeStaleDotlock removes the dotlock file, but only if it is still the
+// file that dotlockStale judged stale.  Another process may have removed the
+// stale lock and created a fresh one since then, and removing that would let
+// both of us hold the lock.  Like liblockfile, it renames the file to a name
+// of our own first, so it can look at what it took without racing anyone,
+// and puts a fresh lock back where it found it.
+func removeStaleDotlock(lockPath string, stale os.FileInfo) (err error) {
+	taken := fmt.Sprintf("%s.%d.stale", lockPath, os.Getpid())
+	err = os.Rename(lockPath, taken)
+	if os.IsNotExist(err) {
+		// Someone else got rid of it first.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(taken)
+	if err == nil && (!os.SameFile(info, stale) || !info.ModTime().Equal(stale.ModTime())) {
+		// We took a lock that someone created after we looked.  Link fails if
+		// yet another lock appeared meanwhile, which still holds the mbox.
+		os.Link(taken, lockPath)
+		os.Remove(taken)
+		return errLockBusy
+	}
+	err = os.Remove(taken)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeDotlock removes the dotlock file, but only if it still holds our
+// process ID.  If another process took it over, thinking it abandoned, the
+// lock belongs to that process now.
+func removeDotlock(lockPath string) (err error) {
+	b, err := os.ReadFile(lockPath)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(b)) != strconv.Itoa(os.Getpid()) {
+		return fmt.Errorf("dotlock %s was taken over by another process", lockPath)
+	}
+	return os.Remove(lockPath)
+}
+
+// dotlockStale determines whether someone abandoned the dotlock file,
+// providing the file's details if they did and nil otherwise.  A lock naming
+// a running process stays, however old, since its holder may simply be busy.
+func dotlockStale(lockPath string, staleAfter time.Duration) os.FileInfo {
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		// It went away on its own, so there's nothing stale to remove.
+		return nil
+	}
+	b, err := os.ReadFile(lockPath)
+	if err != nil {
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err == nil && pid > 0 {
+		if exists, known := processExists(pid); known {
+			if exists {
+				return nil
+			}
+			return info
+		}
+	}
+	// Some programs leave the lock empty, and some platforms can't check on
+	// a process, so only its age can tell us anything.
+	if time.Since(info.ModTime()) > staleAfter {
+		return info
+	}
+	return nil
+}
+
+// Reader provides an MboxReader of the given type over the locked mbox,
+// starting at the beginning of the file.
+func (l *LockedMailbox) Reader(mboxType int) (result *MboxReader, err error) {
+	_, err = l.File.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	result = NewReader(l.File)
+	result.Type = mboxType
+	return result, nil
+}
+
+// Writer provides an MboxWriter of the given type that appends to the end of
+// the locked mbox.
+func (l *LockedMailbox) Writer(mboxType int) (result *MboxWriter, err error) {
+	_, err = l.File.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	result = NewWriter(l.File)
+	result.Type = mboxType
+	return result, nil
+}
+
+// Close releases the locks in the reverse of the order acquired, then closes
+// the file.
+func (l *LockedMailbox) Close() (err error) {
+	for i := len(l.held) - 1; i >= 0; i-- {
+		e := l.unlock(l.held[i])
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	l.held = nil
+	e := l.File.Close()
+	if e != nil && err == nil {
+		err = e
+	}
+	return err
+}
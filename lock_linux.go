@@ -0,0 +1,63 @@
+//go:build linux
+
+package mbox
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// defaultLockMethods follows procmail, taking a dotlock before an fcntl lock.
+var defaultLockMethods = []LockMethod{LockDotlock, LockFcntl}
+
+// flockFile attempts to acquire an flock(2) lock without waiting.
+func flockFile(file *os.File, exclusive bool) (err error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	err = syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errLockBusy
+	}
+	return err
+}
+
+// funlockFile releases an flock(2) lock.
+func funlockFile(file *os.File) (err error) {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+// fcntlLockFile attempts to acquire an fcntl(2) lock over the whole file
+// without waiting.
+func fcntlLockFile(file *os.File, exclusive bool) (err error) {
+	lock := syscall.Flock_t{
+		Type:   syscall.F_RDLCK,
+		Whence: io.SeekStart,
+	}
+	if exclusive {
+		lock.Type = syscall.F_WRLCK
+	}
+	err = syscall.FcntlFlock(file.Fd(), syscall.F_SETLK, &lock)
+	if err == syscall.EAGAIN || err == syscall.EACCES {
+		return errLockBusy
+	}
+	return err
+}
+
+// fcntlUnlockFile releases an fcntl(2) lock.
+func fcntlUnlockFile(file *os.File) (err error) {
+	lock := syscall.Flock_t{
+		Type:   syscall.F_UNLCK,
+		Whence: io.SeekStart,
+	}
+	return syscall.FcntlFlock(file.Fd(), syscall.F_SETLK, &lock)
+}
+
+// processExists determines whether a process with the given ID is running.
+// It can always tell on Linux, so known is always true.
+func processExists(pid int) (exists bool, known bool) {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM, true
+}
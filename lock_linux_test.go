@@ -0,0 +1,120 @@
+//go:build linux
+
+package mbox
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestOpenLockedFlock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockFlock}, Timeout: 50 * time.Millisecond, Retry: 10 * time.Millisecond}
+
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flock locks belong to the open file, so a second open conflicts even
+	// within the same process.
+	_, err = OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err == nil {
+		t.Errorf("expected the second lock to fail")
+	}
+	err = box.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Shared locks don't conflict with each other.
+	first, err := OpenLocked(path, os.O_RDONLY, 0600, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := OpenLocked(path, os.O_RDONLY, 0600, opts)
+	if err != nil {
+		t.Errorf("expected shared locks to succeed: %s", err)
+	} else {
+		second.Close()
+	}
+	first.Close()
+}
+
+func TestOpenLockedAll(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockDotlock, LockFcntl, LockFlock}}
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(box.held) != 3 {
+		t.Errorf("expected 3 locks but held %d", len(box.held))
+	}
+	err = box.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The default methods work for readers, too.
+	box, err = OpenLocked(path, os.O_RDONLY, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box.Close()
+}
+
+func TestDotlockDeadProcess(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Process IDs never get this large on Linux.
+	err = os.WriteFile(path+".lock", []byte(strconv.Itoa(1<<30)+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockDotlock}, Timeout: 50 * time.Millisecond}
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatalf("expected to replace the lock of a dead process: %s", err)
+	}
+	box.Close()
+}
+
+func TestDotlockLiveProcess(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockDotlock}, Timeout: 50 * time.Millisecond, Retry: 10 * time.Millisecond, StaleAfter: time.Minute}
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer box.Close()
+
+	// A holder outliving StaleAfter keeps its lock while it runs.
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path+".lock", old, old)
+	_, err = OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err == nil {
+		t.Errorf("expected the lock of a running process to block us")
+	}
+}
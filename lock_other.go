@@ -0,0 +1,39 @@
+//go:build !linux
+
+package mbox
+
+import (
+	"fmt"
+	"os"
+)
+
+// defaultLockMethods only uses dotlocks, as the others aren't available here.
+var defaultLockMethods = []LockMethod{LockDotlock}
+
+// flockFile reports that flock(2) isn't supported on this platform.
+func flockFile(file *os.File, exclusive bool) (err error) {
+	return fmt.Errorf("flock is not supported on this platform")
+}
+
+// funlockFile reports that flock(2) isn't supported on this platform.
+func funlockFile(file *os.File) (err error) {
+	return fmt.Errorf("flock is not supported on this platform")
+}
+
+// fcntlLockFile reports that fcntl(2) locks aren't supported on this platform.
+func fcntlLockFile(file *os.File, exclusive bool) (err error) {
+	return fmt.Errorf("fcntl locks are not supported on this platform")
+}
+
+// fcntlUnlockFile reports that fcntl(2) locks aren't supported on this
+// platform.
+func fcntlUnlockFile(file *os.File) (err error) {
+	return fmt.Errorf("fcntl locks are not supported on this platform")
+}
+
+// processExists can't tell whether a process exists on this platform, so
+// known is always false, leaving only the age of a dotlock to determine
+// staleness.
+func processExists(pid int) (exists bool, known bool) {
+	return false, false
+}
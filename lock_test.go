@@ -0,0 +1,196 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenLockedDotlock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockDotlock}, Timeout: 50 * time.Millisecond, Retry: 10 * time.Millisecond}
+
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path + ".lock")
+	if err != nil {
+		t.Fatalf("expected a dotlock: %s", err)
+	}
+	if string(b) != fmt.Sprintf("%d\n", os.Getpid()) {
+		t.Errorf("expected the dotlock to hold our pid, but found %s", b)
+	}
+
+	_, err = OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err == nil {
+		t.Errorf("expected the second lock to fail")
+	}
+
+	err = box.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = os.Stat(path + ".lock")
+	if !os.IsNotExist(err) {
+		t.Errorf("expected the dotlock to be removed")
+	}
+}
+
+func TestOpenLockedStaleDotlock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockDotlock}, Timeout: 50 * time.Millisecond, Retry: 10 * time.Millisecond, StaleAfter: time.Minute}
+
+	// A lock older than StaleAfter gets removed.
+	err = os.WriteFile(path+".lock", []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path+".lock", old, old)
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatalf("expected to replace a stale dotlock: %s", err)
+	}
+	box.Close()
+
+	// A fresh lock without a pid is left alone.
+	err = os.WriteFile(path+".lock", []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err == nil {
+		t.Errorf("expected a fresh dotlock to block us")
+	}
+	os.Remove(path + ".lock")
+}
+
+func TestLockedMailboxReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockDotlock}}
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := box.Writer(MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteMail(from3, bytes.NewBuffer([]byte(email3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := box.Reader(MBOXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for reader.Next() {
+		count++
+	}
+	if reader.Err() != nil {
+		t.Error(reader.Err())
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	err = box.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = OpenLocked(filepath.Join(dir, "missing"), os.O_RDONLY, 0600, opts)
+	if err == nil {
+		t.Errorf("expected an error for a missing mbox")
+	}
+	_, err = OpenLocked(path, os.O_RDONLY, 0600, &LockOptions{Methods: []LockMethod{LockMethod(42)}})
+	if err == nil {
+		t.Errorf("expected an error for an unknown lock method")
+	}
+	_, err = io.ReadAll(box.File)
+	if err == nil {
+		t.Errorf("expected the file to be closed")
+	}
+}
+
+func TestRemoveStaleDotlockReplaced(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "mbox.lock")
+	err := os.WriteFile(lockPath, []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(lockPath, old, old)
+	stale := dotlockStale(lockPath, time.Minute)
+	if stale == nil {
+		t.Fatal("expected the old dotlock to be stale")
+	}
+
+	// Someone else replaces the stale lock with their own before we act.
+	os.Remove(lockPath)
+	err = os.WriteFile(lockPath, []byte("1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = removeStaleDotlock(lockPath, stale)
+	if err != errLockBusy {
+		t.Errorf("expected errLockBusy but got %v", err)
+	}
+	b, err := os.ReadFile(lockPath)
+	if err != nil || string(b) != "1\n" {
+		t.Errorf("expected the fresh dotlock to stay but got %q, %v", b, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the dotlock to remain but found %d files", len(entries))
+	}
+}
+
+func TestDotlockTakenOver(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mbox")
+	err := os.WriteFile(path, []byte(mboxo), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &LockOptions{Methods: []LockMethod{LockDotlock}, Timeout: 50 * time.Millisecond}
+	box, err := OpenLocked(path, os.O_RDWR, 0600, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone else decided our lock was stale and replaced it.
+	err = os.WriteFile(path+".lock", []byte("1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = box.Close()
+	if err == nil {
+		t.Errorf("expected an error releasing a lock we no longer hold")
+	}
+	b, err := os.ReadFile(path + ".lock")
+	if err != nil || string(b) != "1\n" {
+		t.Errorf("expected the new owner's lock to stay but got %q, %v", b, err)
+	}
+}
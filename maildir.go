@@ -0,0 +1,212 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maildirLetters maps the flags to the letters Maildir records in the info
+// suffix of a file name, in the alphabetical order Maildir requires.
+var maildirLetters = []struct {
+	letter byte
+	flag   Flags
+}{
+	{'D', FlagDraft},
+	{'F', FlagFlagged},
+	{'R', FlagAnswered},
+	{'S', FlagRead},
+	{'T', FlagDeleted},
+}
+
+// maildirCounter keeps Maildir file names unique within this process.
+var maildirCounter int64
+
+// maildirInfo provides the info suffix of a Maildir file name recording the
+// flags.
+func maildirInfo(f Flags) string {
+	result := []byte(":2,")
+	for _, l := range maildirLetters {
+		if f&l.flag != 0 {
+			result = append(result, l.letter)
+		}
+	}
+	return string(result)
+}
+
+// parseMaildirInfo works out the flags recorded in the info suffix of a
+// Maildir file name.  Any message in 'cur' has been seen, so it is old.
+func parseMaildirInfo(name string) (result Flags) {
+	result = FlagOld
+	_, info, found := strings.Cut(name, ":2,")
+	if !found {
+		return result
+	}
+	for _, l := range maildirLetters {
+		if strings.IndexByte(info, l.letter) >= 0 {
+			result |= l.flag
+		}
+	}
+	return result
+}
+
+// maildirName provides a unique Maildir file name for a message delivered at
+// the given time, following the form Dovecot uses.
+func maildirName(delivered time.Time) string {
+	host, err := os.Hostname()
+	if err != nil || len(host) == 0 {
+		host = "localhost"
+	}
+	// Maildir reserves these characters.
+	host = strings.ReplaceAll(host, "/", `\057`)
+	host = strings.ReplaceAll(host, ":", `\072`)
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s",
+		delivered.Unix(),
+		delivered.Nanosecond()/1000,
+		os.Getpid(),
+		atomic.AddInt64(&maildirCounter, 1),
+		host)
+}
+
+// ExportMaildir writes each message read by reader into the Maildir at dir,
+// creating the Maildir if needed.  New messages go to 'new', while the rest go
+// to 'cur' with an info suffix recording their 'Status' and 'X-Status' flags.
+// Each file name, and modification time, records the date from the message's
+// 'From ' line as the time of delivery.  It returns the number of messages
+// exported.
+func ExportMaildir(dir string, reader *MboxReader) (count int, err error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err = os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for reader.Next() {
+		msg := reader.Message()
+		delivered := msg.Date
+		if delivered.IsZero() {
+			delivered = time.Now()
+		}
+		name := maildirName(delivered)
+		flags := msg.Flags()
+		final := filepath.Join(dir, "new", name)
+		if !flags.New() {
+			final = filepath.Join(dir, "cur", name+maildirInfo(flags))
+		}
+		err = writeMaildirFile(filepath.Join(dir, "tmp", name), final, msg.raw, delivered)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, reader.Err()
+}
+
+// writeMaildirFile writes the message into tmp, then moves it to final, as
+// Maildir requires.
+func writeMaildirFile(tmp string, final string, raw []byte, delivered time.Time) (err error) {
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(raw)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, delivered, delivered)
+	}
+	if err == nil {
+		err = os.Rename(tmp, final)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// maildirEntry describes a message file found in a Maildir.
+type maildirEntry struct {
+	path      string
+	flags     Flags
+	delivered time.Time
+}
+
+// ImportMaildir writes each message in the Maildir at dir to writer, oldest
+// first.  It takes the time of delivery from the file name, or the file's
+// modification time if the name doesn't hold one, and builds each message's
+// 'From ' line from its 'Return-Path' header and the time of delivery.  It
+// replaces the 'Status' and 'X-Status' headers with ones recording the flags
+// from the file name; messages in 'new' get neither.  It returns the number of
+// messages imported.
+func ImportMaildir(dir string, writer *MboxWriter) (count int, err error) {
+	entries := []maildirEntry{}
+	for _, sub := range []string{"new", "cur"} {
+		files, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return 0, err
+		}
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			entry := maildirEntry{path: filepath.Join(dir, sub, file.Name())}
+			if sub == "cur" {
+				entry.flags = parseMaildirInfo(file.Name())
+			}
+			entry.delivered, err = maildirDelivered(file)
+			if err != nil {
+				return 0, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].delivered.Equal(entries[j].delivered) {
+			return entries[i].path < entries[j].path
+		}
+		return entries[i].delivered.Before(entries[j].delivered)
+	})
+
+	for _, entry := range entries {
+		raw, err := os.ReadFile(entry.path)
+		if err != nil {
+			return count, err
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			return count, fmt.Errorf("unable to read %s: %s", entry.path, err)
+		}
+		err = writer.WriteMail(senderFrom(msg.Header, entry.delivered), bytes.NewReader(withFlags(raw, entry.flags, 0)))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// maildirDelivered works out when a Maildir message arrived, from the seconds
+// leading its file name or, failing that, its modification time.
+func maildirDelivered(file os.DirEntry) (result time.Time, err error) {
+	seconds, _, _ := strings.Cut(file.Name(), ".")
+	if unix, e := strconv.ParseInt(seconds, 10, 64); e == nil {
+		return time.Unix(unix, 0), nil
+	}
+	info, err := file.Info()
+	if err != nil {
+		return result, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,147 @@
+package mbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var maildirMbox string = `From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022
+Return-Path: <bubbles@bubbletown.com>
+From: bubbles@bubbletown.com
+Subject: Read and flagged
+Status: RO
+X-Status: F
+
+>From all of us, to all of you, be happy!
+From mrspam@corporate.corp.com Mon Jul  4 15:02:15 2022
+From: mrspam@corporate.corp.com
+Subject: Brand new
+
+Buy now.
+From nobody Mon Jul  4 13:00:00 2022
+From: nobody@nowhere.man
+Subject: Answered and deleted
+Status: O
+X-Status: DA
+
+Boo.
+`
+
+func TestExportMaildir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	reader := NewReader(bytes.NewBufferString(maildirMbox))
+	reader.Type = MBOXRD
+	count, err := ExportMaildir(dir, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	newFiles, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newFiles) != 1 {
+		t.Fatalf("expected 1 new message but got %d", len(newFiles))
+	}
+	if strings.Contains(newFiles[0].Name(), ":2,") {
+		t.Errorf("expected no info on a new message: %s", newFiles[0].Name())
+	}
+	if !strings.HasPrefix(newFiles[0].Name(), "1656946935.") {
+		t.Errorf("expected the name to hold the delivery time: %s", newFiles[0].Name())
+	}
+	curFiles, err := os.ReadDir(filepath.Join(dir, "cur"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := []string{}
+	for _, file := range curFiles {
+		_, info, _ := strings.Cut(file.Name(), ":")
+		infos = append(infos, info)
+	}
+	if strings.Join(infos, "|") != "2,RT|2,FS" {
+		t.Errorf("unexpected info suffixes %v", infos)
+	}
+	tmpFiles, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpFiles) != 0 {
+		t.Errorf("expected tmp to be empty")
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "new", newFiles[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareBodies("From: mrspam@corporate.corp.com\nSubject: Brand new\n\nBuy now.\n", string(b), t)
+}
+
+func TestImportMaildir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	reader := NewReader(bytes.NewBufferString(maildirMbox))
+	reader.Type = MBOXRD
+	_, err := ExportMaildir(dir, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A message without a time in its name uses its modification time.
+	named := filepath.Join(dir, "cur", "oddly-named:2,S")
+	err = os.WriteFile(named, []byte("From: someone@somewhere.org\nSubject: Oddly named\n\nHi.\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	early := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(named, early, early)
+
+	result := bytes.NewBuffer([]byte{})
+	writer := NewWriter(result)
+	writer.Type = MBOXRD
+	count, err := ImportMaildir(dir, writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 messages but got %d", count)
+	}
+
+	box := NewReader(result)
+	box.Type = MBOXRD
+	froms := []string{}
+	subjects := []string{}
+	flags := []Flags{}
+	for box.Next() {
+		froms = append(froms, box.Message().From)
+		subjects = append(subjects, box.Message().Header.Get("Subject"))
+		flags = append(flags, box.Message().Flags())
+	}
+	expectedFroms := []string{
+		"From someone@somewhere.org Fri Jan  1 00:00:00 2021",
+		"From nobody@nowhere.man Mon Jul  4 13:00:00 2022",
+		"From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022",
+		"From mrspam@corporate.corp.com Mon Jul  4 15:02:15 2022",
+	}
+	if strings.Join(froms, "|") != strings.Join(expectedFroms, "|") {
+		t.Errorf("expected %v but got %v", expectedFroms, froms)
+	}
+	expectedFlags := []Flags{
+		FlagOld | FlagRead,
+		FlagOld | FlagAnswered | FlagDeleted,
+		FlagOld | FlagRead | FlagFlagged,
+		0,
+	}
+	for i := range expectedFlags {
+		if i < len(flags) && flags[i] != expectedFlags[i] {
+			t.Errorf("%s: expected flags %b but got %b", subjects[i], expectedFlags[i], flags[i])
+		}
+	}
+
+	_, err = ImportMaildir(filepath.Join(dir, "missing"), writer)
+	if err == nil {
+		t.Errorf("expected an error for a missing Maildir")
+	}
+}
@@ -1,15 +1,17 @@
-// Package mbox provides a flexible mbox reader and writer for four file types.
+// Package mbox provides a flexible mbox reader and writer for four mbox file types, MMDF and Babyl.
 package mbox
 
 /*
 Package mbox implements a reader and writer for working with mbox files.
 
-The package supports four types of mbox files:
+The package supports four types of mbox files, along with MMDF and Babyl:
 
 * mboxo
 * mboxrd
 * mboxcl
 * mboxcl2
+* MMDF
+* Babyl
 
 Type mboxo is the original mbox format.
 
@@ -24,12 +26,23 @@ size of the mail's body.
 Type mboxcl2 tries to address the lines starting with 'From ' by doing what
 mboxcl does, except it doesn't add '>' characters at all.
 
+Type MMDF doesn't rely on 'From ' lines at all, instead opening and closing
+each message with a line of four ^A (\x01) characters.  A 'From ' line may
+follow the opening line; MboxReader builds one from the message's headers when
+it's missing.
+
+Type BABYL reads and writes the Babyl files kept by Emacs Rmail, which end each
+message with ^_ (\x1f) and may hold a reformatted copy of its headers for
+display.  Use BabylReader and BabylWriter to work with those headers, along
+with Babyl's attributes and labels.
+
 You will need to know which type to use when reading or writing an mbox, for
 best results.
 
-NOTE: These routines do not concern themselves with file locking.  You may want
-to consider that while working with mbox files on systems that might actively
-write to the file.  These simply use the golang writer/reader interfaces.
+NOTE: MboxReader and MboxWriter do not concern themselves with file locking.
+They simply use the golang writer/reader interfaces.  When working with mbox
+files on systems that might actively write to the file, use OpenLocked to
+acquire dotlock, flock or fcntl locks before reading or appending.
 
 */
 
@@ -38,4 +51,18 @@ const (
 	MBOXRD             // Specifies the mboxrd mail box file type.
 	MBOXCL             // Specifies the mboxcl mail box file type.
 	MBOXCL2            // Specifies the mboxcl2 mail box file type.
+	MMDF               // Specifies the MMDF mail box file type.
+	BABYL              // Specifies the Babyl mail box file type used by Emacs Rmail.
+)
+
+const (
+	PreserveLineEnding int = iota // Leaves line endings as they are.
+	LFLineEnding                  // Ends each line with '\n'.
+	CRLFLineEnding                // Ends each line with '\r\n'.
+)
+
+const (
+	DefaultParse int = iota // Stops at an unreadable 'Content-Length', as the reader always has, but otherwise acts like LenientParse.
+	StrictParse             // Stops at malformed input, returning a *ParseError.
+	LenientParse            // Recovers from malformed input, recording a *ParseError as a warning.
 )
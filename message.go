@@ -0,0 +1,140 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"net/mail"
+	"time"
+)
+
+// Message describes a single mail read from an mbox by MboxReader.Next.
+type Message struct {
+	From      string      // The 'From ' line that introduced the message.
+	Addr      string      // The address portion of the 'From ' line, as reported by ParseFrom.
+	Date      time.Time   // The date portion of the 'From ' line, as reported by ParseFrom.
+	MoreInfo  string      // Anything following the date on the 'From ' line, as reported by ParseFrom.
+	Header    mail.Header // The message's headers.
+	Body      io.Reader   // The message's body.
+	Offset    int64       // The byte offset of the 'From ' line within the mailbox.
+	Length    int64       // The number of bytes the message occupies within the mailbox.
+	Labels    []string    // The Gmail labels from 'X-GM-LABELS', filled in when MboxReader.Takeout is set.
+	ThreadID  string      // The Gmail thread ID from 'X-GM-THRID', filled in when MboxReader.Takeout is set.
+	BadHeader error       // Why the header couldn't be read, if it couldn't, leaving Header empty and Body holding the whole message.
+	raw       []byte
+}
+
+// newMessage builds a Message from the 'From ' line and the un-escaped bytes
+// MboxReader.NextMessage produced for it.  A message whose header can't be
+// read is still worth keeping in an archive, so it records the problem in
+// BadHeader rather than giving up on the message.
+func newMessage(from string, raw []byte, offset int64, length int64) (msg *Message) {
+	msg = &Message{
+		From:   from,
+		Offset: offset,
+		Length: length,
+		raw:    raw,
+	}
+	// A 'From ' line without a usable date is still a message worth reading,
+	// so we keep whatever ParseFrom managed to work out.
+	msg.Addr, msg.Date, msg.MoreInfo, _ = ParseFrom(from)
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		msg.Header = mail.Header{}
+		msg.Body = bytes.NewReader(raw)
+		msg.BadHeader = err
+		return msg
+	}
+	msg.Header = parsed.Header
+	msg.Body = parsed.Body
+	return msg
+}
+
+// Reader provides the whole message (headers and body) as it would appear
+// outside of the mbox, suitable for handing to MboxWriter.WriteMail along with
+// the From field.
+func (msg *Message) Reader() io.Reader {
+	return bytes.NewReader(msg.raw)
+}
+
+// Next advances the MboxReader to the next message, which one may then
+// retrieve with Message.  It returns false when there are no more messages,
+// or when it encountered an error, which Err reports.  If SkipExpunged is set,
+// it passes over messages whose 'X-Mozilla-Status' marks them expunged.
+func (m *MboxReader) Next() bool {
+	for m.next() {
+		if m.SkipExpunged {
+			status, _ := m.msg.MozillaStatus()
+			if status.Flags&MozillaExpunged != 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// next advances to the next message, whether or not Next should skip it.
+func (m *MboxReader) next() bool {
+	if m.done {
+		return false
+	}
+	m.msg = nil
+	buf := bytes.NewBuffer([]byte{})
+	from, err := m.NextMessage(buf)
+	if err == io.EOF {
+		m.done = true
+		if len(from) == 0 {
+			return false
+		}
+	} else if err != nil {
+		m.done = true
+		m.err = err
+		return false
+	}
+	msg := newMessage(from, buf.Bytes(), m.start, m.end-m.start)
+	if m.Takeout {
+		err = msg.takeoutFields()
+		if err != nil {
+			m.done = true
+			m.err = err
+			return false
+		}
+	}
+	m.msg = msg
+	return true
+}
+
+// Message returns the message found by the most recent call to Next.
+func (m *MboxReader) Message() *Message {
+	return m.msg
+}
+
+// Err returns the error that stopped Next, if any.  Reaching the end of the
+// mbox is not an error.
+func (m *MboxReader) Err() error {
+	return m.err
+}
+
+// All provides an iterator over the remaining messages in the mbox, suitable
+// for use with range-over-func:
+//
+//	for msg, err := range reader.All() {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(msg.Header.Get("Subject"))
+//	}
+//
+// The iterator yields a nil message with the error that stopped it, if any.
+func (m *MboxReader) All() func(yield func(*Message, error) bool) {
+	return func(yield func(*Message, error) bool) {
+		for m.Next() {
+			if !yield(m.Message(), nil) {
+				return
+			}
+		}
+		if m.err != nil {
+			yield(nil, m.err)
+		}
+	}
+}
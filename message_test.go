@@ -0,0 +1,175 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReaderNext(t *testing.T) {
+	box := NewReader(bytes.NewBuffer([]byte(mboxcl)))
+	box.Type = MBOXCL
+
+	expectedFroms := []string{"From someone", "From someone-else", "From nobody"}
+	expectedSubjects := []string{"To interpretation", "Bestest offer in the universe!!11!!", "Mysterious Jenkins"}
+	expectedBodies := []string{
+		"From all of us, to all of you, be happy!\n",
+		"You won't believe these prices!\nFrom 1 cent to 11 cents, we carry the least expensive\nline of jets this side of the Gobi Desert!\n",
+		"",
+	}
+	count := 0
+	for box.Next() {
+		msg := box.Message()
+		if count >= len(expectedFroms) {
+			t.Fatalf("found more messages than expected")
+		}
+		if msg.From != expectedFroms[count] {
+			t.Errorf("expected %s but got %s", expectedFroms[count], msg.From)
+		}
+		subject := msg.Header.Get("Subject")
+		if subject != expectedSubjects[count] {
+			t.Errorf("expected %s but got %s", expectedSubjects[count], subject)
+		}
+		b, err := io.ReadAll(msg.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		CompareBodies(expectedBodies[count], string(b), t)
+
+		offset := int64(strings.Index(mboxcl, expectedFroms[count]+"\n"))
+		if msg.Offset != offset {
+			t.Errorf("expected offset %d but got %d", offset, msg.Offset)
+		}
+		end := int64(len(mboxcl))
+		if count+1 < len(expectedFroms) {
+			end = int64(strings.Index(mboxcl, expectedFroms[count+1]+"\n"))
+		}
+		if msg.Length != end-offset {
+			t.Errorf("expected length %d but got %d", end-offset, msg.Length)
+		}
+		count++
+	}
+	if box.Err() != nil {
+		t.Error(box.Err())
+	}
+	if count != len(expectedFroms) {
+		t.Errorf("expected %d messages but got %d", len(expectedFroms), count)
+	}
+	if box.Next() {
+		t.Errorf("expected no more messages")
+	}
+}
+
+func TestReaderNextParsesFrom(t *testing.T) {
+	mb := `From pi@rpi.cu Mon Jul  4 19:23:45 2022 remote from rpi
+From: pi@rpi.cu
+Subject: Hello
+
+Hi.
+`
+	box := NewReader(bytes.NewBuffer([]byte(mb)))
+	if !box.Next() {
+		t.Fatalf("expected a message, but got none: %v", box.Err())
+	}
+	msg := box.Message()
+	if msg.Addr != "pi@rpi.cu" {
+		t.Errorf("expected pi@rpi.cu but got %s", msg.Addr)
+	}
+	expectedTime := time.Date(2022, time.July, 4, 19, 23, 45, 0, time.UTC)
+	if msg.Date != expectedTime {
+		t.Errorf("expected %s but got %s", expectedTime, msg.Date)
+	}
+	if msg.MoreInfo != "remote from rpi" {
+		t.Errorf("expected 'remote from rpi' but got '%s'", msg.MoreInfo)
+	}
+	raw, err := io.ReadAll(msg.Reader())
+	if err != nil {
+		t.Error(err)
+	}
+	CompareBodies("From: pi@rpi.cu\nSubject: Hello\n\nHi.\n", string(raw), t)
+}
+
+func TestReaderNextError(t *testing.T) {
+	box := NewReader(bytes.NewBuffer([]byte(badmboxcl)))
+	box.Type = MBOXCL
+	if box.Next() {
+		t.Errorf("expected no message, but got one")
+	}
+	if box.Err() == nil {
+		t.Errorf("expected an error, but got nil")
+	}
+}
+
+func TestReaderAll(t *testing.T) {
+	box := NewReader(bytes.NewBuffer([]byte(mboxo)))
+	subjects := []string{}
+	box.All()(func(msg *Message, err error) bool {
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+		subjects = append(subjects, msg.Header.Get("Subject"))
+		return true
+	})
+	if len(subjects) != 2 {
+		t.Fatalf("expected 2 messages but got %d", len(subjects))
+	}
+	if subjects[1] != "Bestest offer in the universe!!11!!" {
+		t.Errorf("unexpected subject %s", subjects[1])
+	}
+
+	// Stopping early must leave the remaining messages alone.
+	box = NewReader(bytes.NewBuffer([]byte(mboxo)))
+	count := 0
+	box.All()(func(msg *Message, err error) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("expected to stop after 1 message, but saw %d", count)
+	}
+	if !box.Next() {
+		t.Errorf("expected another message after stopping early")
+	}
+
+	box = NewReader(bytes.NewBuffer([]byte(badmboxcl)))
+	box.Type = MBOXCL
+	var found error
+	box.All()(func(msg *Message, err error) bool {
+		found = err
+		return true
+	})
+	if found == nil {
+		t.Errorf("expected the iterator to yield an error")
+	}
+}
+
+func TestReaderNextBadHeader(t *testing.T) {
+	box := NewReader(strings.NewReader("From a\nSubject: one\n\nfirst\n\nFrom b\nhello world\n\nFrom c\nSubject: three\n\nthird\n"))
+	froms := []string{}
+	for box.Next() {
+		msg := box.Message()
+		froms = append(froms, msg.From)
+		if msg.From != "From b" {
+			if msg.BadHeader != nil {
+				t.Errorf("unexpected header problem for %s: %s", msg.From, msg.BadHeader)
+			}
+			continue
+		}
+		if msg.BadHeader == nil || len(msg.Header) != 0 {
+			t.Errorf("expected a header problem and an empty header but got %v", msg.Header)
+		}
+		body, _ := io.ReadAll(msg.Body)
+		if string(body) != "hello world\n\n" {
+			t.Errorf("expected the whole message as the body but got %q", body)
+		}
+	}
+	if box.Err() != nil {
+		t.Fatal(box.Err())
+	}
+	if strings.Join(froms, ",") != "From a,From b,From c" {
+		t.Errorf("expected every message but got %v", froms)
+	}
+}
@@ -0,0 +1,298 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mhSequencesFile names the file in an MH folder recording its sequences.
+const mhSequencesFile = ".mh_sequences"
+
+// mhSequenceFlags maps the MH sequences this package understands to flags.
+// The 'unseen' sequence works the other way around, holding the messages that
+// haven't been read.
+var mhSequenceFlags = []struct {
+	sequence string
+	flag     Flags
+}{
+	{"flagged", FlagFlagged},
+	{"replied", FlagAnswered},
+}
+
+// parseMHSequences reads the sequences in an .mh_sequences file, mapping each
+// sequence name to the message numbers it holds.  Each line looks like
+// 'unseen: 1-3 7 9'.  Ranges stop at highest, the last message in the
+// folder, so a range like '1-2000000000' doesn't fill memory with messages
+// that don't exist.
+func parseMHSequences(data []byte, highest int) (result map[string]map[int]bool) {
+	result = map[string]map[int]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, list, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := result[name]; !ok {
+			result[name] = map[int]bool{}
+		}
+		for _, field := range strings.Fields(list) {
+			low, high, isRange := strings.Cut(field, "-")
+			first, err := strconv.Atoi(low)
+			if err != nil {
+				continue
+			}
+			last := first
+			if isRange {
+				last, err = strconv.Atoi(high)
+				if err != nil {
+					continue
+				}
+				if last > highest {
+					last = highest
+				}
+			}
+			for n := first; n <= last; n++ {
+				result[name][n] = true
+			}
+		}
+	}
+	return result
+}
+
+// formatMHSequences provides the contents of an .mh_sequences file holding
+// the sequences, collapsing consecutive message numbers into ranges.  It
+// leaves out empty sequences.
+func formatMHSequences(sequences map[string]map[int]bool) []byte {
+	names := []string{}
+	for name, numbers := range sequences {
+		if len(numbers) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := bytes.NewBuffer([]byte{})
+	for _, name := range names {
+		numbers := []int{}
+		for n := range sequences[name] {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		result.WriteString(name + ":")
+		for i := 0; i < len(numbers); {
+			j := i
+			for j+1 < len(numbers) && numbers[j+1] == numbers[j]+1 {
+				j++
+			}
+			if i == j {
+				result.WriteString(fmt.Sprintf(" %d", numbers[i]))
+			} else {
+				result.WriteString(fmt.Sprintf(" %d-%d", numbers[i], numbers[j]))
+			}
+			i = j + 1
+		}
+		result.WriteString("\n")
+	}
+	return result.Bytes()
+}
+
+// mhMessages provides the numbers of the messages in the MH folder at dir, in
+// numeric order.  MH names each message file with its number, so anything
+// else doesn't hold a message.
+func mhMessages(dir string) (result []int, err error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		n, err := strconv.Atoi(file.Name())
+		if err != nil || n <= 0 || strconv.Itoa(n) != file.Name() || file.IsDir() {
+			continue
+		}
+		result = append(result, n)
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
+// readMHSequences reads the sequences of the MH folder at dir, if it has any.
+// The numbers give the messages in the folder, in numeric order, as
+// mhMessages provides them.
+func readMHSequences(dir string, numbers []int) (result map[string]map[int]bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, mhSequencesFile))
+	if os.IsNotExist(err) {
+		return map[string]map[int]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	highest := 0
+	if len(numbers) > 0 {
+		highest = numbers[len(numbers)-1]
+	}
+	return parseMHSequences(data, highest), nil
+}
+
+// ExportMH writes each message read by reader into the MH folder at dir,
+// creating the folder if needed.  New messages follow any already in the
+// folder.  It records the 'Status' and 'X-Status' flags of each message in
+// the folder's 'unseen', 'flagged' and 'replied' sequences, rewriting
+// .mh_sequences once all the messages are written.  It returns the number of
+// messages exported.
+func ExportMH(dir string, reader *MboxReader) (count int, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := mhMessages(dir)
+	if err != nil {
+		return 0, err
+	}
+	sequences, err := readMHSequences(dir, existing)
+	if err != nil {
+		return 0, err
+	}
+	next := 1
+	if len(existing) > 0 {
+		next = existing[len(existing)-1] + 1
+	}
+	addTo := func(sequence string, n int) {
+		if _, ok := sequences[sequence]; !ok {
+			sequences[sequence] = map[int]bool{}
+		}
+		sequences[sequence][n] = true
+	}
+
+	for reader.Next() {
+		msg := reader.Message()
+		err = writeNewFile(filepath.Join(dir, strconv.Itoa(next)), msg.raw)
+		if err != nil {
+			break
+		}
+		flags := msg.Flags()
+		if flags&FlagRead == 0 {
+			addTo("unseen", next)
+		}
+		for _, s := range mhSequenceFlags {
+			if flags&s.flag != 0 {
+				addTo(s.sequence, next)
+			}
+		}
+		next++
+		count++
+	}
+	if err == nil {
+		err = reader.Err()
+	}
+	// Even if something went wrong, record the sequences of the messages
+	// already written.
+	seqErr := writeMHSequences(dir, sequences)
+	if err == nil {
+		err = seqErr
+	}
+	return count, err
+}
+
+// writeNewFile writes a message file, refusing to replace one already there.
+func writeNewFile(path string, raw []byte) (err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(raw)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// writeMHSequences replaces the .mh_sequences file of the MH folder at dir,
+// writing a temporary file first so readers never see half of it.
+func writeMHSequences(dir string, sequences map[string]map[int]bool) (err error) {
+	tmp, err := os.CreateTemp(dir, mhSequencesFile+"_*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(formatMHSequences(sequences))
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, mhSequencesFile))
+}
+
+// ImportMH writes each message in the MH folder at dir to writer, in numeric
+// order.  It builds each message's 'From ' line from its 'Return-Path' header
+// and its 'Date' header, or the file's modification time if the date is
+// missing.  It replaces the 'Status' and 'X-Status' headers with ones
+// recording the folder's 'unseen', 'flagged' and 'replied' sequences; a
+// message outside 'unseen' has been read.  It returns the number of messages
+// imported.
+func ImportMH(dir string, writer *MboxWriter) (count int, err error) {
+	numbers, err := mhMessages(dir)
+	if err != nil {
+		return 0, err
+	}
+	sequences, err := readMHSequences(dir, numbers)
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range numbers {
+		path := filepath.Join(dir, strconv.Itoa(n))
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return count, err
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			return count, fmt.Errorf("unable to read %s: %s", path, err)
+		}
+		delivered, err := msg.Header.Date()
+		if err != nil {
+			delivered, err = mhModTime(path)
+			if err != nil {
+				return count, err
+			}
+		}
+		flags := Flags(0)
+		if !sequences["unseen"][n] {
+			flags |= FlagRead | FlagOld
+		}
+		for _, s := range mhSequenceFlags {
+			if sequences[s.sequence][n] {
+				flags |= s.flag
+			}
+		}
+		err = writer.WriteMail(senderFrom(msg.Header, delivered), bytes.NewReader(withFlags(raw, flags, 0)))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// mhModTime provides the modification time of the file at path.
+func mhModTime(path string) (result time.Time, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return result, err
+	}
+	return info.ModTime(), nil
+}
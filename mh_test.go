@@ -0,0 +1,115 @@
+package mbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMHSequences(t *testing.T) {
+	sequences := parseMHSequences([]byte("unseen: 1-3 7\ncur: 9\nbroken\nflagged: x 5\n"), 9)
+	expected := map[string]map[int]bool{
+		"unseen":  {1: true, 2: true, 3: true, 7: true},
+		"cur":     {9: true},
+		"flagged": {5: true},
+	}
+	if !reflect.DeepEqual(sequences, expected) {
+		t.Errorf("expected %v but got %v", expected, sequences)
+	}
+	sequences["replied"] = map[int]bool{}
+	result := string(formatMHSequences(sequences))
+	if result != "cur: 9\nflagged: 5\nunseen: 1-3 7\n" {
+		t.Errorf("unexpected sequences: %q", result)
+	}
+	huge := parseMHSequences([]byte("unseen: 2-2000000000\n"), 4)
+	if !reflect.DeepEqual(huge["unseen"], map[int]bool{2: true, 3: true, 4: true}) {
+		t.Errorf("expected the range to stop at the last message but got %v", huge["unseen"])
+	}
+}
+
+func TestExportMH(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "inbox")
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "4"), []byte("Subject: Already here\n\nHi.\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, mhSequencesFile), []byte("cur: 4\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewReader(strings.NewReader(maildirMbox))
+	reader.Type = MBOXRD
+	count, err := ExportMH(dir, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	numbers, err := mhMessages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(numbers, []int{4, 5, 6, 7}) {
+		t.Errorf("unexpected messages: %v", numbers)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "\nFrom all of us") {
+		t.Errorf("expected the body un-escaped: %q", raw)
+	}
+	sequences, err := os.ReadFile(filepath.Join(dir, mhSequencesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sequences) != "cur: 4\nflagged: 5\nreplied: 7\nunseen: 6-7\n" {
+		t.Errorf("unexpected sequences: %q", sequences)
+	}
+}
+
+func TestImportMH(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"10": "Return-Path: <mrspam@corporate.corp.com>\nDate: Mon, 04 Jul 2022 15:02:15 +0000\nSubject: Second\n\nBuy now.\n",
+		"2":  "From: bubbles@bubbletown.com\nDate: Mon, 04 Jul 2022 14:23:45 +0000\nSubject: First\nStatus: O\n\nHello.\n",
+		",3": "Subject: Removed\n\nGone.\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(filepath.Join(dir, mhSequencesFile), []byte("unseen: 10\nflagged: 2\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	writer := NewWriter(buf)
+	writer.Type = MBOXRD
+	count, err := ImportMH(dir, writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 messages but got %d", count)
+	}
+	expected := "From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022\n" +
+		"From: bubbles@bubbletown.com\nDate: Mon, 04 Jul 2022 14:23:45 +0000\nSubject: First\nStatus: RO\nX-Status: F\n\nHello.\n\n" +
+		"From mrspam@corporate.corp.com Mon Jul  4 15:02:15 2022\n" +
+		"Return-Path: <mrspam@corporate.corp.com>\nDate: Mon, 04 Jul 2022 15:02:15 +0000\nSubject: Second\n\nBuy now.\n\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
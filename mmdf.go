@@ -0,0 +1,171 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// mmdfDelimiter opens and closes every message in an MMDF mailbox.
+const mmdfDelimiter = "\x01\x01\x01\x01"
+
+// isMMDFDelimiter determines whether the line is an MMDF message delimiter.
+func isMMDFDelimiter(line []byte) bool {
+	return string(bytes.TrimRight(line, "\r\n")) == mmdfDelimiter
+}
+
+// nextMMDFMessage parses MMDF files.  Each message sits between a pair of
+// delimiter lines, and may begin with a 'From ' line.  If it doesn't, we
+// build one from its headers, so callers can rely on having one.
+func (m *MboxReader) nextMMDFMessage(write io.Writer) (from string, err error) {
+	m.headerEnd = -1
+	// Anything between messages isn't part of one.
+	for {
+		b, err := m.read.ReadBytes('\n')
+		m.offset += int64(len(b))
+		if isMMDFDelimiter(b) {
+			m.start = m.offset - int64(len(b))
+			break
+		}
+		if m.Lossless {
+			m.preamble = append(m.preamble, b...)
+		}
+		if err != nil {
+			m.end = m.offset
+			return "", err
+		}
+	}
+
+	header := bytes.NewBuffer([]byte{})
+	first := true
+	for {
+		b, err := m.read.ReadBytes('\n')
+		m.offset += int64(len(b))
+		if isMMDFDelimiter(b) {
+			m.end = m.offset
+			break
+		}
+		if first && bytes.HasPrefix(b, []byte("From ")) {
+			from = strings.TrimSuffix(string(b), "\n")
+			first = false
+			continue
+		}
+		first = false
+		if m.headerEnd < 0 && len(b) > 0 {
+			if isBlankLine(b) {
+				// The first blank line ends the header.
+				m.headerEnd = m.offset
+			} else {
+				header.Write(b)
+			}
+		}
+		write.Write(b)
+		if err != nil {
+			// The mailbox ended without closing the message.
+			m.end = m.offset
+			if err == io.EOF {
+				if problem := m.problem(ErrTruncatedMessage, m.offset); problem != nil {
+					return mmdfFrom(from, header.Bytes()), problem
+				}
+			}
+			return mmdfFrom(from, header.Bytes()), err
+		}
+	}
+	from = mmdfFrom(from, header.Bytes())
+	if m.Lossless {
+		// The line endings between messages belong to the next Preamble.
+		return from, nil
+	}
+
+	// Skip the line endings between messages, so we can report the last one
+	// along with io.EOF, as the other types do.
+	for {
+		peek, err := m.read.Peek(1)
+		if err != nil {
+			return from, err
+		}
+		if peek[0] != '\n' && peek[0] != '\r' {
+			return from, nil
+		}
+		m.read.ReadByte()
+		m.offset++
+	}
+}
+
+// mmdfFrom provides the 'From ' line for an MMDF message, building one from
+// the message's headers when it lacks one.
+func mmdfFrom(from string, header []byte) string {
+	if len(from) > 0 {
+		return from
+	}
+	header = append(header, '\n')
+	parsed, err := mail.ReadMessage(bytes.NewReader(header))
+	if err != nil {
+		return senderFrom(mail.Header{}, time.Time{})
+	}
+	date, _ := parsed.Header.Date()
+	return senderFrom(parsed.Header, date)
+}
+
+// writeMMDFMail writes the email using MMDF formatting.  MMDF has no way to
+// escape a line matching its delimiter, so it refuses mail holding one.  In
+// lossless mode, it leaves out a 'From ' line matching the one an MboxReader
+// would build from the mail's headers, since the mail never had it.
+func (m *MboxWriter) writeMMDFMail(from string, mail io.Reader) (err error) {
+	_, err = m.write.Write([]byte(mmdfDelimiter + m.eol))
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(mail)
+	header := &bytes.Buffer{}
+	for {
+		b, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		header.Write(b)
+		if readErr == io.EOF || isBlankLine(b) {
+			break
+		}
+	}
+	madeUp := m.Lossless && "From "+strings.TrimSuffix(from, "\r") == mmdfFrom("", header.Bytes())
+	if len(from) > 0 && !madeUp {
+		_, err = m.write.Write(m.fromLine(from))
+		if err != nil {
+			return err
+		}
+	}
+	reader = bufio.NewReader(io.MultiReader(header, reader))
+	last := byte('\n')
+	for {
+		b, readErr := reader.ReadBytes('\n')
+		if isMMDFDelimiter(b) {
+			return fmt.Errorf("mmdf can't hold a line matching its delimiter")
+		}
+		if len(b) > 0 {
+			_, err = m.write.Write(b)
+			if err != nil {
+				return err
+			}
+			last = b[len(b)-1]
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if last != '\n' {
+		_, err = m.write.Write([]byte(m.eol))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = m.write.Write([]byte(mmdfDelimiter + m.eol))
+	return err
+}
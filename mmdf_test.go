@@ -0,0 +1,145 @@
+package mbox
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+var mmdfBox string = "\x01\x01\x01\x01\n" +
+	"From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022\n" +
+	"From: bubbles@bubbletown.com\n" +
+	"Subject: To interpretation\n" +
+	"\n" +
+	"From all of us, to all of you, be happy!\n" +
+	"\x01\x01\x01\x01\n" +
+	"\n" +
+	"\x01\x01\x01\x01\n" +
+	"Return-Path: <mrspam@corporate.corp.com>\n" +
+	"From: mrspam@corporate.corp.com\n" +
+	"Date: Mon, 04 Jul 2022 15:02:15 +0000\n" +
+	"Subject: Bestest offer in the universe!!11!!\n" +
+	"\n" +
+	"You won't believe these prices!\n" +
+	"\x01\x01\x01\x01\n"
+
+func TestReadMMDF(t *testing.T) {
+	reader := NewReader(strings.NewReader(mmdfBox))
+	reader.Type = MMDF
+	messages := []*Message{}
+	for reader.Next() {
+		messages = append(messages, reader.Message())
+	}
+	if reader.Err() != nil {
+		t.Fatal(reader.Err())
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages but got %d", len(messages))
+	}
+	if messages[0].From != "From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022" {
+		t.Errorf("unexpected From line: %q", messages[0].From)
+	}
+	body, _ := io.ReadAll(messages[0].Body)
+	if string(body) != "From all of us, to all of you, be happy!\n" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if messages[1].From != "From mrspam@corporate.corp.com Mon Jul  4 15:02:15 2022" {
+		t.Errorf("expected a From line built from the headers but got %q", messages[1].From)
+	}
+	if messages[1].Header.Get("Subject") != "Bestest offer in the universe!!11!!" {
+		t.Errorf("unexpected subject: %s", messages[1].Header.Get("Subject"))
+	}
+	second := int64(strings.Index(mmdfBox, "\x01\x01\x01\x01\nReturn-Path"))
+	if messages[1].Offset != second {
+		t.Errorf("expected offset %d but got %d", second, messages[1].Offset)
+	}
+	if messages[1].Offset+messages[1].Length != int64(len(mmdfBox)) {
+		t.Errorf("expected the message to end at %d but got %d", len(mmdfBox), messages[1].Offset+messages[1].Length)
+	}
+}
+
+func TestReadMMDFUnterminated(t *testing.T) {
+	unterminated := "\x01\x01\x01\x01\nFrom someone\nSubject: Cut off\n\nHalf a"
+	reader := NewReader(strings.NewReader(unterminated))
+	reader.Type = MMDF
+	reader.ParseMode = StrictParse
+	if reader.Next() || !errors.Is(reader.Err(), ErrTruncatedMessage) {
+		t.Errorf("expected ErrTruncatedMessage but got %v", reader.Err())
+	}
+
+	reader = NewReader(strings.NewReader(unterminated))
+	reader.Type = MMDF
+	reader.ParseMode = LenientParse
+	if !reader.Next() {
+		t.Fatalf("expected a message: %v", reader.Err())
+	}
+	body, _ := io.ReadAll(reader.Message().Body)
+	if string(body) != "Half a" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if warnings := reader.Warnings(); len(warnings) != 1 || !errors.Is(warnings[0], ErrTruncatedMessage) {
+		t.Errorf("expected a truncation warning but got %v", warnings)
+	}
+	if reader.Next() {
+		t.Error("expected no more messages")
+	}
+}
+
+func TestWriteMMDF(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	writer := NewWriter(buf)
+	writer.Type = MMDF
+	err := writer.WriteMail("From bubbles@bubbletown.com Mon Jul  4 14:23:45 2022", strings.NewReader("From: bubbles@bubbletown.com\nSubject: To interpretation\n\nFrom all of us, to all of you, be happy!\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteMail("", strings.NewReader("Return-Path: <mrspam@corporate.corp.com>\nFrom: mrspam@corporate.corp.com\nDate: Mon, 04 Jul 2022 15:02:15 +0000\nSubject: Bestest offer in the universe!!11!!\n\nYou won't believe these prices!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(mmdfBox, "\x01\x01\x01\x01\n\n", "\x01\x01\x01\x01\n", 1)
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\nbut got:\n%q", expected, buf.String())
+	}
+
+	err = writer.WriteMail("From someone", strings.NewReader("Subject: Trouble\n\n\x01\x01\x01\x01\n"))
+	if err == nil {
+		t.Error("expected an error writing a delimiter line")
+	}
+}
+
+func TestDetectMMDF(t *testing.T) {
+	reader := strings.NewReader(mmdfBox)
+	mType, err := DetectType(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mType != MMDF {
+		t.Errorf("expected %d but got %d", MMDF, mType)
+	}
+	if pos, _ := reader.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Errorf("expected the reader back at the start but it's at %d", pos)
+	}
+}
+
+func TestIndexMMDF(t *testing.T) {
+	idx, err := BuildIndex(strings.NewReader(mmdfBox), MMDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 2 {
+		t.Fatalf("expected 2 entries but got %d", idx.Len())
+	}
+	msg, err := NewRandomReader(strings.NewReader(mmdfBox), idx).Message(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("From") != "mrspam@corporate.corp.com" {
+		t.Errorf("unexpected From header: %s", msg.Header.Get("From"))
+	}
+	if msg.Offset != idx.Entries[1].From {
+		t.Errorf("expected offset %d but got %d", idx.Entries[1].From, msg.Offset)
+	}
+}
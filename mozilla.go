@@ -0,0 +1,152 @@
+package mbox
+
+import (
+	"fmt"
+	"io"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// MozillaFlags describes the flags Thunderbird records in the hex-encoded
+// 'X-Mozilla-Status' (the low 16 bits) and 'X-Mozilla-Status2' (the high 16
+// bits) headers.
+type MozillaFlags uint32
+
+const (
+	MozillaRead            MozillaFlags = 0x00000001 // The message has been read.
+	MozillaReplied         MozillaFlags = 0x00000002 // The message has been replied to.
+	MozillaMarked          MozillaFlags = 0x00000004 // The message has been starred.
+	MozillaExpunged        MozillaFlags = 0x00000008 // The message has been deleted, but the folder not yet compacted.
+	MozillaHasRe           MozillaFlags = 0x00000010 // The subject had 'Re:' stripped from it.
+	MozillaElided          MozillaFlags = 0x00000020 // The thread holding the message is collapsed.
+	MozillaOffline         MozillaFlags = 0x00000080 // The message is available offline.
+	MozillaWatched         MozillaFlags = 0x00000100 // The thread holding the message is watched.
+	MozillaSenderAuthed    MozillaFlags = 0x00000200 // The sender has been authenticated.
+	MozillaPartial         MozillaFlags = 0x00000400 // Only part of the message has been downloaded.
+	MozillaQueued          MozillaFlags = 0x00000800 // The message is queued for delivery.
+	MozillaForwarded       MozillaFlags = 0x00001000 // The message has been forwarded.
+	MozillaPriorities      MozillaFlags = 0x0000E000 // A mask holding the message's priority.
+	MozillaNew             MozillaFlags = 0x00010000 // The message arrived since the folder was last opened.
+	MozillaIgnored         MozillaFlags = 0x00040000 // The thread holding the message is ignored.
+	MozillaIMAPDeleted     MozillaFlags = 0x00200000 // The message is marked deleted on the IMAP server.
+	MozillaMDNReportNeeded MozillaFlags = 0x00400000 // The sender asked for a read receipt.
+	MozillaMDNReportSent   MozillaFlags = 0x00800000 // A read receipt has been sent.
+	MozillaTemplate        MozillaFlags = 0x01000000 // The message is a template.
+	MozillaLabels          MozillaFlags = 0x0E000000 // A mask holding the message's old-style label.
+	MozillaAttachment      MozillaFlags = 0x10000000 // The message has attachments.
+)
+
+// mozillaKeysWidth describes the space Thunderbird reserves for the
+// 'X-Mozilla-Keys' header, so it may add tags later without moving the rest
+// of the mbox.
+const mozillaKeysWidth = 80
+
+// MozillaStatus describes the state Thunderbird records for a message.
+type MozillaStatus struct {
+	Flags MozillaFlags // The flags from 'X-Mozilla-Status' and 'X-Mozilla-Status2'.
+	Keys  []string     // The tags from 'X-Mozilla-Keys'.
+}
+
+// ParseMozillaStatus reads the 'X-Mozilla-Status', 'X-Mozilla-Status2' and
+// 'X-Mozilla-Keys' headers.  Missing headers leave the corresponding flags or
+// keys empty.
+func ParseMozillaStatus(header mail.Header) (result MozillaStatus, err error) {
+	status, err := parseMozillaHex(header, "X-Mozilla-Status")
+	if err != nil {
+		return result, err
+	}
+	status2, err := parseMozillaHex(header, "X-Mozilla-Status2")
+	if err != nil {
+		return result, err
+	}
+	result.Flags = MozillaFlags(status&0xFFFF | status2&0xFFFF0000)
+	result.Keys = strings.Fields(header.Get("X-Mozilla-Keys"))
+	return result, nil
+}
+
+func parseMozillaHex(header mail.Header, name string) (result uint64, err error) {
+	value := strings.TrimSpace(header.Get(name))
+	if len(value) == 0 {
+		return 0, nil
+	}
+	result, err = strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %s", name, err)
+	}
+	return result, nil
+}
+
+// MozillaStatus provides the state Thunderbird recorded in the message's
+// headers.
+func (msg *Message) MozillaStatus() (result MozillaStatus, err error) {
+	return ParseMozillaStatus(msg.Header)
+}
+
+// Flags translates the Thunderbird flags to the flags other mail clients
+// record in the 'Status' and 'X-Status' headers.
+func (f MozillaFlags) Flags() (result Flags) {
+	if f&MozillaRead != 0 {
+		result |= FlagRead
+	}
+	if f&MozillaNew == 0 {
+		result |= FlagOld
+	}
+	if f&MozillaReplied != 0 {
+		result |= FlagAnswered
+	}
+	if f&MozillaMarked != 0 {
+		result |= FlagFlagged
+	}
+	if f&(MozillaExpunged|MozillaIMAPDeleted) != 0 {
+		result |= FlagDeleted
+	}
+	return result
+}
+
+// MozillaFlagsFrom translates the flags other mail clients record in the
+// 'Status' and 'X-Status' headers to Thunderbird flags.
+func MozillaFlagsFrom(f Flags) (result MozillaFlags) {
+	if f&FlagRead != 0 {
+		result |= MozillaRead
+	}
+	if f.New() {
+		result |= MozillaNew
+	}
+	if f&FlagAnswered != 0 {
+		result |= MozillaReplied
+	}
+	if f&FlagFlagged != 0 {
+		result |= MozillaMarked
+	}
+	if f&FlagDeleted != 0 {
+		result |= MozillaExpunged
+	}
+	return result
+}
+
+// headerLines provides the header lines recording the status, formatted the
+// way Thunderbird writes them.
+func (s MozillaStatus) headerLines() []string {
+	keys := strings.Join(s.Keys, " ")
+	if len(keys) < mozillaKeysWidth {
+		keys += strings.Repeat(" ", mozillaKeysWidth-len(keys))
+	}
+	return []string{
+		fmt.Sprintf("X-Mozilla-Status: %04x", uint32(s.Flags)&0xFFFF),
+		fmt.Sprintf("X-Mozilla-Status2: %08x", uint32(s.Flags)&0xFFFF0000),
+		"X-Mozilla-Keys: " + keys,
+	}
+}
+
+// WriteMozillaMail adds new mail to the mbox, just as WriteMail does, but
+// records the status in the 'X-Mozilla-Status', 'X-Mozilla-Status2' and
+// 'X-Mozilla-Keys' headers Thunderbird uses, replacing any already in the
+// mail.
+func (m *MboxWriter) WriteMozillaMail(from string, status MozillaStatus, mail io.Reader) (err error) {
+	mail, err = rewriteMailHeader(mail, dropHeaders("X-Mozilla-Status", "X-Mozilla-Status2", "X-Mozilla-Keys"), status.headerLines())
+	if err != nil {
+		return err
+	}
+	return m.WriteMail(from, mail)
+}
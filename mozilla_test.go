@@ -0,0 +1,135 @@
+package mbox
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+var thunderbirdMbox string = `From - Mon Jul  4 19:23:45 2022
+X-Mozilla-Status: 0001
+X-Mozilla-Status2: 00000000
+X-Mozilla-Keys: $label1 important
+From: bubbles@bubbletown.com
+Subject: Still here
+
+Hi.
+
+From - Mon Jul  4 19:24:45 2022
+X-Mozilla-Status: 0009
+X-Mozilla-Status2: 00000000
+X-Mozilla-Keys:
+From: mrspam@corporate.corp.com
+Subject: Deleted, but not compacted
+
+Buy now.
+
+From - Mon Jul  4 19:25:45 2022
+X-Mozilla-Status: 0000
+X-Mozilla-Status2: 00010000
+From: nobody@nowhere.man
+Subject: Brand new
+
+Boo.
+`
+
+func TestParseMozillaStatus(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader("X-Mozilla-Status: 1003\nX-Mozilla-Status2: 10010000\nX-Mozilla-Keys: $label1 todo   \n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := ParseMozillaStatus(msg.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MozillaRead | MozillaReplied | MozillaForwarded | MozillaNew | MozillaAttachment
+	if status.Flags != expected {
+		t.Errorf("expected %08x but got %08x", expected, status.Flags)
+	}
+	if len(status.Keys) != 2 || status.Keys[0] != "$label1" || status.Keys[1] != "todo" {
+		t.Errorf("unexpected keys %v", status.Keys)
+	}
+	if status.Flags.Flags() != FlagRead|FlagAnswered {
+		t.Errorf("unexpected flags %b", status.Flags.Flags())
+	}
+
+	msg, err = mail.ReadMessage(strings.NewReader("X-Mozilla-Status: moo\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseMozillaStatus(msg.Header)
+	if err == nil {
+		t.Errorf("expected an error for a bad status")
+	}
+}
+
+func TestMozillaFlagsFrom(t *testing.T) {
+	f := MozillaFlagsFrom(FlagRead | FlagOld | FlagFlagged | FlagDeleted)
+	if f != MozillaRead|MozillaMarked|MozillaExpunged {
+		t.Errorf("unexpected flags %08x", f)
+	}
+	if MozillaFlagsFrom(0) != MozillaNew {
+		t.Errorf("expected a new message to be new")
+	}
+	if f.Flags() != FlagRead|FlagOld|FlagFlagged|FlagDeleted {
+		t.Errorf("unexpected flags %b", f.Flags())
+	}
+}
+
+func TestReaderSkipExpunged(t *testing.T) {
+	box := NewReader(bytes.NewBufferString(thunderbirdMbox))
+	subjects := []string{}
+	for box.Next() {
+		subjects = append(subjects, box.Message().Header.Get("Subject"))
+	}
+	if len(subjects) != 3 {
+		t.Errorf("expected 3 messages but got %d", len(subjects))
+	}
+
+	box = NewReader(bytes.NewBufferString(thunderbirdMbox))
+	box.SkipExpunged = true
+	subjects = []string{}
+	for box.Next() {
+		status, err := box.Message().MozillaStatus()
+		if err != nil {
+			t.Error(err)
+		}
+		if status.Flags&MozillaExpunged != 0 {
+			t.Errorf("expected expunged messages to be skipped")
+		}
+		subjects = append(subjects, box.Message().Header.Get("Subject"))
+	}
+	if len(subjects) != 2 || subjects[1] != "Brand new" {
+		t.Errorf("unexpected messages %v", subjects)
+	}
+}
+
+func TestWriteMozillaMail(t *testing.T) {
+	result := bytes.NewBuffer([]byte{})
+	writer := NewWriter(result)
+	writer.Type = MBOXRD
+	mb := "From: bubbles@bubbletown.com\nX-Mozilla-Status: 0000\nSubject: Hi\n\nFrom me.\n"
+	status := MozillaStatus{Flags: MozillaRead | MozillaMarked | MozillaNew, Keys: []string{"$label2"}}
+	err := writer.WriteMozillaMail("bubbles@bubbletown.com", status, strings.NewReader(mb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "From bubbles@bubbletown.com\nFrom: bubbles@bubbletown.com\nSubject: Hi\n" +
+		"X-Mozilla-Status: 0005\nX-Mozilla-Status2: 00010000\nX-Mozilla-Keys: $label2" + strings.Repeat(" ", 73) + "\n" +
+		"\n>From me.\n\n"
+	CompareBodies(expected, result.String(), t)
+
+	box := NewReader(result)
+	box.Type = MBOXRD
+	if !box.Next() {
+		t.Fatal(box.Err())
+	}
+	found, err := box.Message().MozillaStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Flags != status.Flags || len(found.Keys) != 1 || found.Keys[0] != "$label2" {
+		t.Errorf("expected %+v but got %+v", status, found)
+	}
+}
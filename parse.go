@@ -0,0 +1,64 @@
+package mbox
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBadContentLength      = errors.New("invalid Content-Length")                                // A 'Content-Length' header that isn't a non-negative number, or ends its body partway through a line.
+	ErrContentLengthOverrun  = errors.New("length in Content-Length runs into the next message")   // A 'Content-Length' header counting a 'From ' line starting the next message.
+	ErrContentLengthUnderrun = errors.New("length in Content-Length ends before the message does") // A 'Content-Length' header ending the body short of the next 'From ' line.
+	ErrMissingFromLine       = errors.New("missing From line")                                     // No 'From ' line where a message should start.
+	ErrTruncatedMessage      = errors.New("mbox ends partway through a message")                   // The mbox ending before the message does.
+)
+
+// ParseError describes malformed input found while reading an mbox.  Use
+// errors.Is to compare it with ErrBadContentLength and the like.
+type ParseError struct {
+	Err    error // What went wrong, such as ErrBadContentLength.
+	Index  int   // The position of the message within the mbox, counting from zero.
+	Offset int64 // The offset within the mbox where the problem turned up.
+}
+
+// Error describes the problem.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("message %d at offset %d: %s", e.Index, e.Offset, e.Err)
+}
+
+// Unwrap provides the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Warnings provides the problems LenientParse or DefaultParse mode recovered
+// from while reading the last message.
+func (m *MboxReader) Warnings() []*ParseError {
+	return m.warnings
+}
+
+// problem reports err, found at offset within the message being read.  In
+// StrictParse mode, it provides a *ParseError to stop reading.  Otherwise, it
+// records a warning and returns nil.  As mboxcl2 leaves
+// 'From ' lines in bodies alone, once its lengths can't be trusted, only a
+// 'From ' line holding a date starts the next message.
+func (m *MboxReader) problem(err error, offset int64) error {
+	p := &ParseError{Err: err, Index: m.count, Offset: offset}
+	if m.ParseMode == StrictParse {
+		return p
+	}
+	m.warnings = append(m.warnings, p)
+	m.resync = m.Type == MBOXCL2
+	return nil
+}
+
+// plausibleFrom determines whether the 'From ' line holds a date, making it
+// likely to start a message rather than sit within one.
+func plausibleFrom(line string) bool {
+	_, date, _, err := ParseFrom(line)
+	return err == nil && !date.IsZero()
+}
+
+// errNextMessage tells nextMessageGeneric that the line reader found the
+// 'From ' line starting the next message, and left it in MboxReader.from.
+var errNextMessage = errors.New("next message")
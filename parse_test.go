@@ -0,0 +1,196 @@
+package mbox
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// shortCL2 gives its first message a 'Content-Length' too short to reach the
+// end of its body, which holds an unescaped 'From ' line.
+var shortCL2 = "From a@b Mon Jan  1 00:00:00 2024\n" +
+	"Subject: one\n" +
+	"Content-Length: 5\n" +
+	"\n" +
+	"body\n" +
+	"more body\n" +
+	"From the top, again\n" +
+	"\n" +
+	"From c@d Mon Jan  1 00:00:00 2024\n" +
+	"Subject: two\n" +
+	"Content-Length: 5\n" +
+	"\n" +
+	"last\n"
+
+// longCL gives its first message a 'Content-Length' running into the next.
+var longCL = "From a@b Mon Jan  1 00:00:00 2024\n" +
+	"Subject: one\n" +
+	"Content-Length: 50\n" +
+	"\n" +
+	"body\n" +
+	"From c@d Mon Jan  1 00:00:00 2024\n" +
+	"Subject: two\n" +
+	"Content-Length: 5\n" +
+	"\n" +
+	"last\n"
+
+// readAll reads every message, providing each along with the warnings found
+// while reading it.
+func readAll(reader *MboxReader) (messages []string, warnings [][]*ParseError, err error) {
+	for {
+		msg := bytes.NewBuffer([]byte{})
+		from, err := reader.NextMessage(msg)
+		if len(from) > 0 {
+			messages = append(messages, msg.String())
+			warnings = append(warnings, reader.Warnings())
+		}
+		if err == io.EOF {
+			return messages, warnings, nil
+		}
+		if err != nil {
+			return messages, warnings, err
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		mboxType int
+		mbox     string
+		expected error
+		index    int
+		offset   int64
+	}{
+		{"bad length", MBOXCL, badmboxcl, ErrBadContentLength, 0, 96},
+		{"short length", MBOXCL2, shortCL2, ErrContentLengthUnderrun, 0, 71},
+		{"long length", MBOXCL, longCL, ErrContentLengthOverrun, 0, 72},
+		{"long length mboxcl2", MBOXCL2, longCL, ErrContentLengthOverrun, 0, 72},
+		{"long length past the end", MBOXCL2, strings.Replace(longCL, "Content-Length: 50", "Content-Length: 90", 1), ErrContentLengthOverrun, 0, 72},
+		{"truncated", MBOXCL, badlenmboxcl, ErrTruncatedMessage, 1, int64(len(badlenmboxcl))},
+		{"no from line", MBOXO, "\nnot an mbox\n", ErrMissingFromLine, 0, 1},
+	}
+	for _, test := range tests {
+		reader := NewReader(strings.NewReader(test.mbox))
+		reader.Type = test.mboxType
+		reader.ParseMode = StrictParse
+		_, _, err := readAll(reader)
+		parseErr := &ParseError{}
+		if !errors.As(err, &parseErr) || !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expected, err)
+			continue
+		}
+		if parseErr.Index != test.index || parseErr.Offset != test.offset {
+			t.Errorf("%s: expected message %d at offset %d but got %d at %d", test.name, test.index, test.offset, parseErr.Index, parseErr.Offset)
+		}
+	}
+}
+
+func TestLenientParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		mboxType int
+		mbox     string
+		messages []string
+		warnings []error
+	}{
+		{"bad length", MBOXCL, badmboxcl, []string{
+			"From: bubbles@bubbletown.com\nTo: mrmxpdstk@lazytown.com\nSubject: To interpretation\nContent-Length: ts\n\nFrom all of us, to all of you, be happy!\n",
+			"Content-Length: 130\nFrom: mrspam@corporate.corp.com\nTo: mrmxpdstk@lazytown.com\nSubject: Bestest offer in the universe!!11!!\n\nYou won't believe these prices!\nFrom 1 cent to 11 cents, we carry the least expensive\nline of jets this side of the Gobi Desert!\n",
+		}, []error{ErrBadContentLength, nil}},
+		{"short length", MBOXCL2, shortCL2, []string{
+			"Subject: one\nContent-Length: 5\n\nbody\nmore body\nFrom the top, again\n\n",
+			"Subject: two\nContent-Length: 5\n\nlast\n",
+		}, []error{ErrContentLengthUnderrun, nil}},
+		{"long length", MBOXCL, longCL, []string{
+			"Subject: one\nContent-Length: 50\n\nbody\n",
+			"Subject: two\nContent-Length: 5\n\nlast\n",
+		}, []error{ErrContentLengthOverrun, nil}},
+		{"long length mboxcl2", MBOXCL2, longCL, []string{
+			"Subject: one\nContent-Length: 50\n\nbody\n",
+			"Subject: two\nContent-Length: 5\n\nlast\n",
+		}, []error{ErrContentLengthOverrun, nil}},
+	}
+	for _, test := range tests {
+		reader := NewReader(strings.NewReader(test.mbox))
+		reader.Type = test.mboxType
+		reader.ParseMode = LenientParse
+		messages, warnings, err := readAll(reader)
+		if err != nil {
+			t.Errorf("%s: expected no error but got %s", test.name, err)
+			continue
+		}
+		if len(messages) != len(test.messages) {
+			t.Errorf("%s: expected %d messages but got %d", test.name, len(test.messages), len(messages))
+			continue
+		}
+		for i := range messages {
+			CompareBodies(test.messages[i], messages[i], t)
+			if test.warnings[i] == nil && len(warnings[i]) > 0 {
+				t.Errorf("%s: expected no warnings for message %d but got %v", test.name, i, warnings[i])
+			}
+			if test.warnings[i] != nil && (len(warnings[i]) != 1 || !errors.Is(warnings[i][0], test.warnings[i])) {
+				t.Errorf("%s: expected %v for message %d but got %v", test.name, test.warnings[i], i, warnings[i])
+			}
+		}
+	}
+}
+
+func TestDefaultParse(t *testing.T) {
+	// By default, only an unreadable length stops the reader.
+	for _, mbox := range []string{shortCL2, longCL, "\nnot an mbox\n"} {
+		reader := NewReader(strings.NewReader(mbox))
+		reader.Type = MBOXCL2
+		_, _, err := readAll(reader)
+		if err != nil {
+			t.Errorf("expected no error but got %s", err)
+		}
+	}
+	reader := NewReader(strings.NewReader(badmboxcl))
+	reader.Type = MBOXCL
+	_, _, err := readAll(reader)
+	if !errors.Is(err, ErrBadContentLength) {
+		t.Errorf("expected ErrBadContentLength but got %v", err)
+	}
+}
+
+func TestLenientNoFromLine(t *testing.T) {
+	reader := NewReader(strings.NewReader("\nnot an mbox\n"))
+	reader.ParseMode = LenientParse
+	if reader.Next() {
+		t.Fatal("expected no messages")
+	}
+	if reader.Err() != nil {
+		t.Errorf("expected no error but got %s", reader.Err())
+	}
+	if warnings := reader.Warnings(); len(warnings) != 1 || !errors.Is(warnings[0], ErrMissingFromLine) {
+		t.Errorf("expected a missing From line warning but got %v", warnings)
+	}
+}
+
+func TestMBOXCL2DatedFromInBody(t *testing.T) {
+	// A correct length keeps a 'From ' line holding a date within the body.
+	mbox := "From a@b Mon Jan  1 00:00:00 2024\n" +
+		"Content-Length: 48\n" +
+		"\n" +
+		"Forwarded:\n" +
+		"From c@d Mon Jan  1 00:00:00 2024\n" +
+		"hi\n" +
+		"\n" +
+		"From e@f Mon Jan  1 00:00:00 2024\n" +
+		"Content-Length: 5\n" +
+		"\n" +
+		"last\n"
+	reader := NewReader(strings.NewReader(mbox))
+	reader.Type = MBOXCL2
+	messages, _, err := readAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages but got %d", len(messages))
+	}
+	CompareBodies("Content-Length: 48\n\nForwarded:\nFrom c@d Mon Jan  1 00:00:00 2024\nhi\n\n", messages[0], t)
+}
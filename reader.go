@@ -2,6 +2,7 @@ package mbox
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"regexp"
@@ -11,13 +12,31 @@ import (
 
 // MboxReader provides a reader for mbox files.
 type MboxReader struct {
-	Type int // Specifies the type of MboxReader, defaulting to MBOXO.
-	from string
-	read *bufio.Reader
+	Type         int  // Specifies the type of MboxReader, defaulting to MBOXO.
+	SkipExpunged bool // Specifies whether Next skips messages Thunderbird deleted without compacting the mbox.
+	Takeout      bool // Specifies whether Next fills in the Gmail labels and thread ID found in Gmail Takeout exports.
+	Lossless     bool // Specifies whether messages keep every byte of the mbox, such as a final line lacking a line ending, for an MboxWriter with Lossless set to reproduce.
+	LineEnding   int  // Specifies the line ending messages get, defaulting to PreserveLineEnding.
+	ParseMode    int  // Specifies how to handle malformed input, defaulting to DefaultParse.
+	from         string
+	read         *bufio.Reader
+	offset       int64    // Bytes consumed from the underlying reader so far.
+	fromOffset   int64    // Offset of the 'From ' line held in from.
+	start        int64    // Offset of the 'From ' line of the last message read.
+	headerEnd    int64    // Offset of the body of the last message read, or -1 if it had none.
+	end          int64    // Offset just past the last message read.
+	msg          *Message // The message most recently produced by Next.
+	err          error    // The error that stopped Next, if any.
+	done         bool     // Whether Next has run out of messages.
+	babyl        *babylState
+	count        int           // The number of messages read so far.
+	warnings     []*ParseError // The problems LenientParse recovered from in the last message.
+	resync       bool          // Whether a problem means only a 'From ' line holding a date may end the message.
+	preamble     []byte        // The bytes preceding the last message that belong to no message, kept in Lossless mode.
 }
 
 // lineReader is a function you provide to MboxReader.nextMessageGeneric that either ignores or processes
-// a line of text from the mail box.  If it returns false, the line is written as-is to the message.
+// a line of text from the mail box, including its line ending.  If it returns false, the line is written as-is to the message.
 // Otherwise, the line is not passed to the message unless the function does so on its own somehow.
 // It may return an error if it encounters something unrecoverable, suggesting a malformed mbox file.
 type lineReader func(string) (bool, error)
@@ -33,7 +52,46 @@ func NewReader(read io.Reader) *MboxReader {
 // NextMessage writes the next message into the writer.
 // This returns the 'From ' string that separates the mbox email, and an err for an error.
 // This returns an io.EOF error when the last message is read.
+// MMDF and Babyl messages lacking a 'From ' line get one built from their headers.
+// Unless LineEnding is PreserveLineEnding, the message gets the given line
+// ending, and the 'From ' string loses any trailing '\r'.  Content-Length
+// headers keep describing the body as it sits in the mbox.
+// Malformed input produces a *ParseError in StrictParse mode, while
+// LenientParse mode carries on, leaving the problems for Warnings.
+// DefaultParse mode only stops at an unreadable 'Content-Length'.
 func (m *MboxReader) NextMessage(write io.Writer) (from string, err error) {
+	m.warnings = nil
+	m.resync = false
+	m.preamble = nil
+	if m.LineEnding == PreserveLineEnding {
+		from, err = m.nextMessage(write)
+	} else {
+		converter := &lineEndingWriter{write: write, ending: m.LineEnding}
+		from, err = m.nextMessage(converter)
+		flushErr := converter.flush()
+		if err == nil {
+			err = flushErr
+		}
+		from = strings.TrimSuffix(from, "\r")
+	}
+	if len(from) > 0 {
+		m.count++
+	}
+	return from, err
+}
+
+// Preamble provides the bytes preceding the message NextMessage last read
+// that belong to no message, such as text ahead of the first 'From ' line, or
+// the blank lines between MMDF messages.  After NextMessage returns io.EOF
+// without a message, it provides whatever followed the last one.  Only
+// Lossless mode keeps these bytes; otherwise, Preamble provides nil.  Pass
+// them to MboxWriter.WritePreamble to reproduce them.
+func (m *MboxReader) Preamble() []byte {
+	return m.preamble
+}
+
+// nextMessage writes the next message into the writer, as the type requires.
+func (m *MboxReader) nextMessage(write io.Writer) (from string, err error) {
 	switch m.Type {
 	case MBOXRD:
 		return m.nextMBOXRDMessage(write)
@@ -41,6 +99,10 @@ func (m *MboxReader) NextMessage(write io.Writer) (from string, err error) {
 		return m.nextMBOXCLMessage(write)
 	case MBOXCL2:
 		return m.nextMBOXCL2Message(write)
+	case MMDF:
+		return m.nextMMDFMessage(write)
+	case BABYL:
+		return m.nextBabylMessage(write)
 	default:
 		return m.nextMBOXOMessage(write)
 	}
@@ -49,45 +111,82 @@ func (m *MboxReader) NextMessage(write io.Writer) (from string, err error) {
 // nextMessageGeneric is a common parser that handles most of the needs for parsing an mbox.
 func (m *MboxReader) nextMessageGeneric(write io.Writer, fn lineReader) (from string, err error) {
 	inMessage := false
+	m.headerEnd = -1
 	if len(m.from) > 0 {
 		// We have already read the From line.
 		from = m.from
+		m.start = m.fromOffset
 		inMessage = true
 	}
+	stray := int64(-1)
+	finish := func(err error) (string, error) {
+		m.end = m.offset
+		if len(from) == 0 && stray >= 0 && err == io.EOF {
+			// Nothing here looked like an mbox.
+			if problem := m.problem(ErrMissingFromLine, stray); problem != nil {
+				return "", problem
+			}
+		}
+		return from, err
+	}
 	for {
-		b, err := m.read.ReadBytes('\n')
-		if err != nil {
-			return from, err
+		b, readErr := m.read.ReadBytes('\n')
+		m.offset += int64(len(b))
+		if len(b) == 0 {
+			return finish(readErr)
+		}
+		if readErr != nil && !m.Lossless {
+			// The mbox lacks a final line ending, so we supply one.
+			b = append(b, '\n')
 		}
-		line := string(b[:len(b)-1])
-		if strings.HasPrefix(line, "From ") {
+		line := strings.TrimSuffix(string(b), "\n")
+		if strings.HasPrefix(line, "From ") && !(inMessage && m.resync && !plausibleFrom(line)) {
 			if inMessage {
 				// We've finished the message... this starts a new one.
 				m.from = line
-				// Since we've finished, break out of scanning.
-				break
-			} else {
-				// We're starting a new message.
-				from = line
-				continue
+				m.fromOffset = m.offset - int64(len(b))
+				m.end = m.fromOffset
+				// Since we've finished, stop scanning.
+				return from, nil
+			}
+			// We're starting a new message.
+			from = line
+			m.start = m.offset - int64(len(b))
+		} else if len(from) == 0 {
+			// Anything preceding the first 'From ' line isn't part of a message.
+			if stray < 0 && !isBlankLine(b) {
+				stray = m.offset - int64(len(b))
+			}
+			if m.Lossless {
+				m.preamble = append(m.preamble, b...)
+			}
+		} else {
+			if isBlankLine(b) && m.headerEnd < 0 {
+				// The first blank line ends the header.
+				m.headerEnd = m.offset
 			}
-		}
 
-		if len(line) == 0 && !inMessage {
-			inMessage = true
-		}
+			if isBlankLine(b) && !inMessage {
+				inMessage = true
+			}
 
-		ok, err := fn(line)
-		if err != nil {
-			return from, err
+			ok, err := fn(string(b))
+			if err == errNextMessage {
+				m.end = m.fromOffset
+				return from, nil
+			}
+			if err != nil {
+				m.end = m.offset
+				return from, err
+			}
+			if !ok {
+				write.Write(b)
+			}
 		}
-		if ok {
-			continue
+		if readErr != nil {
+			return finish(readErr)
 		}
-
-		write.Write([]byte(fmt.Sprintf("%s\n", line)))
 	}
-	return from, err
 }
 
 // nextMBOXOMessage parses mboxo files.
@@ -107,7 +206,7 @@ func (m *MboxReader) nextMBOXRDMessage(write io.Writer) (from string, err error)
 	return m.nextMessageGeneric(write, func(line string) (ok bool, err error) {
 		if re.Match([]byte(line)) {
 			// We need to remove the first character before writing.
-			write.Write([]byte(fmt.Sprintf("%s\n", line[1:])))
+			write.Write([]byte(line[1:]))
 			return true, nil
 		}
 		return false, nil
@@ -127,45 +226,76 @@ func (m *MboxReader) nextMBOXCLMessage(write io.Writer) (from string, err error)
 		// This should only happen if I didn't test the regular expression properly.
 		panic(err)
 	}
-	size := int64(0)
+	size := int64(-1)
+	inBody := false
+	counted := false
 	return m.nextMessageGeneric(write, func(line string) (bool, error) {
+		if err := m.checkAfterBody(&counted, line); err != nil {
+			return true, err
+		}
 		if re.Match([]byte(line)) {
 			// We need to remove the first character before writing.
-			write.Write([]byte(fmt.Sprintf("%s\n", line[1:])))
+			write.Write([]byte(line[1:]))
 			return true, nil
 		}
-		if strings.HasPrefix(strings.ToLower(line), "content-length: ") {
-			size, err = strconv.ParseInt(line[16:], 10, 64)
-			if err != nil {
-				return false, fmt.Errorf("failed to parse Content-Length: %s", err)
-			}
+		if inBody {
+			// Anything following the counted body, such as a blank line before
+			// the next 'From ' line, still belongs to the message.
 			return false, nil
 		}
-		if len(line) == 0 {
+		if isContentLength(line) {
+			size, err = m.readContentLength(line)
+			return false, err
+		}
+		if isBlankLine([]byte(line)) {
 			// We are now in the body.
 			// But, we still need to look for our regular expression.
 			// We shouldn't read the whole message at once, but we should look for lines.
 			// We must count bytes.
-			write.Write([]byte{'\n'})
-			if size == 0 {
-				// We have the body already... it's empty.
+			inBody = true
+			write.Write([]byte(line))
+			if size < 0 {
+				// Without a length, the body runs to the next 'From ' line.
 				return true, nil
 			}
-			for {
+			counted = true
+			for size > 0 {
+				at := m.offset
 				b, err := m.read.ReadBytes('\n')
-				if err != nil {
-					// Probably no more data.
-					return true, err
+				m.offset += int64(len(b))
+				if bytes.HasPrefix(b, []byte("From ")) {
+					// Only the next message starts with an unescaped 'From ' line.
+					if problem := m.problem(ErrContentLengthOverrun, at); problem != nil {
+						return true, problem
+					}
+					m.from = strings.TrimSuffix(string(b), "\n")
+					m.fromOffset = at
+					return true, errNextMessage
 				}
 				// Decrementing the size we allocated earlier.
 				size -= int64(len(b))
+				if err != nil && len(b) > 0 && !m.Lossless {
+					b = append(b, '\n')
+				}
 				if re.Match(b) {
 					write.Write(b[1:])
 				} else {
 					write.Write(b)
 				}
-				if size <= 0 {
-					break
+				if err == io.EOF && size > 0 {
+					if problem := m.problem(ErrTruncatedMessage, m.offset); problem != nil {
+						return true, problem
+					}
+				}
+				if err != nil {
+					// Probably no more data.
+					return true, err
+				}
+			}
+			if size < 0 {
+				// The body ends partway through a line.
+				if problem := m.problem(ErrBadContentLength, m.offset); problem != nil {
+					return true, problem
 				}
 			}
 			return true, nil
@@ -180,21 +310,152 @@ func (m *MboxReader) nextMBOXCL2Message(write io.Writer) (from string, err error
 	// We want the 'Content-Length:' header in the email, which tells us the size of the
 	// body of the email.  So we have to detect when we are no longer reading headers
 	// (the first blank line), and write the whole body into the writer.
-	size := int64(0)
+	size := int64(-1)
+	inBody := false
+	counted := false
 	return m.nextMessageGeneric(write, func(line string) (bool, error) {
-		if strings.HasPrefix(strings.ToLower(line), "content-length: ") {
-			size, err = strconv.ParseInt(line[16:], 10, 64)
-			if err != nil {
-				return false, fmt.Errorf("failed to parse Content-Length: %s", err)
-			}
+		if err := m.checkAfterBody(&counted, line); err != nil {
+			return true, err
+		}
+		if inBody {
+			// Anything following the counted body, such as a blank line before
+			// the next 'From ' line, still belongs to the message.
 			return false, nil
 		}
-		if len(line) == 0 {
+		if isContentLength(line) {
+			size, err = m.readContentLength(line)
+			return false, err
+		}
+		if isBlankLine([]byte(line)) {
 			// We are now in the body.
-			write.Write([]byte{'\n'})
-			io.CopyN(write, m.read, size)
-			return true, nil
+			inBody = true
+			write.Write([]byte(line))
+			if size < 0 {
+				// Without a length, the body runs to the next 'From ' line.
+				return true, nil
+			}
+			counted = true
+			return true, m.readMBOXCL2Body(write, size)
 		}
 		return false, nil
 	})
 }
+
+// readMBOXCL2Body copies the size bytes of body following the header to
+// write.  Since mboxcl2 leaves 'From ' lines in bodies alone, a 'From ' line
+// holding a date within the body might start the next message instead, if
+// the length runs too long.  We hold back everything from such a line on
+// until we see whether the length ends the body where it should.
+func (m *MboxReader) readMBOXCL2Body(write io.Writer, size int64) (err error) {
+	body := bufio.NewReader(io.LimitReader(m.read, size))
+	held := []byte{}
+	heldAt := int64(-1)
+	read := int64(0)
+	for {
+		b, readErr := body.ReadBytes('\n')
+		m.offset += int64(len(b))
+		read += int64(len(b))
+		if heldAt < 0 && bytes.HasPrefix(b, []byte("From ")) && plausibleFrom(strings.TrimSuffix(string(b), "\n")) {
+			heldAt = m.offset - int64(len(b))
+		}
+		if heldAt >= 0 {
+			held = append(held, b...)
+		} else {
+			write.Write(b)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if heldAt >= 0 && (read < size || !m.bodyEndsHere()) {
+		return m.overrun(held, heldAt)
+	}
+	write.Write(held)
+	if read < size {
+		return m.problem(ErrTruncatedMessage, m.offset)
+	}
+	return nil
+}
+
+// overrun reports a 'Content-Length' counting the 'From ' line starting
+// held, at offset, which starts the next message.  In LenientParse mode, it
+// gives back the rest of held to read as the next message.
+func (m *MboxReader) overrun(held []byte, offset int64) error {
+	if problem := m.problem(ErrContentLengthOverrun, offset); problem != nil {
+		return problem
+	}
+	line, rest, _ := bytes.Cut(held, []byte("\n"))
+	m.from = string(line)
+	m.fromOffset = offset
+	m.offset -= int64(len(rest))
+	m.read = bufio.NewReader(io.MultiReader(bytes.NewReader(rest), m.read))
+	return errNextMessage
+}
+
+// bodyEndsHere determines whether nothing but blank lines separate the
+// reader from the next 'From ' line or the end of the mbox, as they should
+// following a body measured by 'Content-Length'.  It only looks as far ahead
+// as the reader's buffer allows.
+func (m *MboxReader) bodyEndsHere() bool {
+	// A short peek just means we're near the end of the mbox.
+	ahead, _ := m.read.Peek(m.read.Size())
+	for len(ahead) > 0 {
+		end := bytes.IndexByte(ahead, '\n') + 1
+		if end == 0 {
+			end = len(ahead)
+		}
+		if !isBlankLine(ahead[:end]) {
+			return bytes.HasPrefix(ahead, []byte("From "))
+		}
+		ahead = ahead[end:]
+	}
+	return true
+}
+
+// readContentLength reads the length given by a 'Content-Length' header line,
+// providing -1 if the line doesn't hold one, so the body runs to the next
+// 'From ' line.
+func (m *MboxReader) readContentLength(line string) (size int64, err error) {
+	size, err = parseContentLength(line)
+	if err != nil || size < 0 {
+		offset := m.offset - int64(len(line))
+		if m.ParseMode == DefaultParse {
+			return -1, &ParseError{Err: ErrBadContentLength, Index: m.count, Offset: offset}
+		}
+		return -1, m.problem(ErrBadContentLength, offset)
+	}
+	return size, nil
+}
+
+// checkAfterBody reports a problem if line, following a body measured by
+// 'Content-Length', isn't a blank line.  A correct length leaves nothing but
+// blank lines before the 'From ' line starting the next message, so the
+// length must be too short.  It only reports the first such line.
+func (m *MboxReader) checkAfterBody(counted *bool, line string) error {
+	if !*counted || isBlankLine([]byte(line)) {
+		return nil
+	}
+	*counted = false
+	return m.problem(ErrContentLengthUnderrun, m.offset-int64(len(line)))
+}
+
+// isContentLength determines whether the header line is a 'Content-Length'
+// header.
+func isContentLength(line string) bool {
+	name, _, found := strings.Cut(line, ":")
+	return found && strings.EqualFold(name, "Content-Length")
+}
+
+// parseContentLength provides the length a 'Content-Length' header line
+// gives, ignoring the white space and line ending around it.
+func parseContentLength(line string) (size int64, err error) {
+	_, value, _ := strings.Cut(line, ":")
+	size, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse Content-Length: %s", err)
+	}
+	return size, nil
+}
@@ -443,3 +443,61 @@ func TestReadMBOXCL2BadContentLength(t *testing.T) {
 		t.Errorf("expected an error, but it worked")
 	}
 }
+
+func TestReadSkipsLeadingLines(t *testing.T) {
+	box := NewReader(bytes.NewBuffer([]byte("\nnot a message\n" + mboxcl)))
+	box.Type = MBOXCL2
+	msgStream := bytes.NewBuffer([]byte{})
+	from, err := box.NextMessage(msgStream)
+	if err != nil {
+		t.Errorf("expected no error but got %s", err)
+	}
+	expectedFrom := "From someone"
+	if from != expectedFrom {
+		t.Errorf("expected %s but got %s", expectedFrom, from)
+	}
+	CompareBodies(`From: bubbles@bubbletown.com
+To: mrmxpdstk@lazytown.com
+Subject: To interpretation
+Content-Length: 42
+
+>From all of us, to all of you, be happy!
+`, msgStream.String(), t)
+}
+
+func TestReadUnterminatedLine(t *testing.T) {
+	original := "From someone\nSubject: Cut short\n\nNo final line ending"
+	for _, lossless := range []bool{false, true} {
+		box := NewReader(bytes.NewBuffer([]byte(original)))
+		box.Lossless = lossless
+		msgStream := bytes.NewBuffer([]byte{})
+		_, err := box.NextMessage(msgStream)
+		if err != io.EOF {
+			t.Errorf("expected EOF but got %v", err)
+		}
+		expected := "Subject: Cut short\n\nNo final line ending"
+		if !lossless {
+			expected += "\n"
+		}
+		CompareBodies(expected, msgStream.String(), t)
+	}
+}
+
+func TestReadPreamble(t *testing.T) {
+	original := "Junk\n\nFrom someone\nSubject: After junk\n\nbody\n"
+	for _, lossless := range []bool{false, true} {
+		box := NewReader(bytes.NewBufferString(original))
+		box.Lossless = lossless
+		from, err := box.NextMessage(io.Discard)
+		if from != "From someone" || err != io.EOF {
+			t.Errorf("expected the message and EOF but got %q and %v", from, err)
+		}
+		expected := ""
+		if lossless {
+			expected = "Junk\n\n"
+		}
+		if string(box.Preamble()) != expected {
+			t.Errorf("expected preamble %q but got %q", expected, box.Preamble())
+		}
+	}
+}
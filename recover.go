@@ -0,0 +1,99 @@
+package mbox
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// RecoveryReader reads a damaged MBOXCL or MBOXCL2 mbox, where a wrong
+// 'Content-Length' header would otherwise swallow the messages following it,
+// or cut a message short.  It only trusts a 'From ' line holding a date, as
+// ParseFrom reads it, to start a message.  When a message's length doesn't
+// bring it to such a line, perhaps after some blank lines, or the end of the
+// mbox, it ends the message at the next such line instead, and reports it in
+// Reconstructed.  Use NewRecoveryReader to instantiate.
+type RecoveryReader struct {
+	Type          int                    // The type of mbox, either MBOXCL or MBOXCL2.
+	Reconstructed []ContentLengthProblem // The messages read so far whose bodies had to be worked out from the 'From ' lines.
+	read          io.ReaderAt
+	size          int64
+	boundaries    *boundaries
+	pos           int64 // The offset of the next message.
+	count         int   // The number of messages read so far.
+	msg           *Message
+	err           error
+}
+
+// NewRecoveryReader creates a RecoveryReader for the mbox of the given type in
+// read, which holds size bytes.  It finds every 'From ' line up front, so
+// expect it to read the whole mbox once before the first message.
+func NewRecoveryReader(read io.ReaderAt, size int64, mboxType int) (result *RecoveryReader, err error) {
+	bounds, err := findBoundaries(read, size)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryReader{Type: mboxType, read: read, size: size, boundaries: bounds, pos: bounds.next(0)}, nil
+}
+
+// Next advances to the next message, returning false when there are no more
+// messages or it encounters an error.  Check Err to tell which.
+func (r *RecoveryReader) Next() bool {
+	r.msg = nil
+	if r.err != nil || r.pos >= r.size {
+		return false
+	}
+	entry, err := readLengthHeader(r.read, r.size, r.pos)
+	if err != nil {
+		r.err = err
+		return false
+	}
+	entry.end, err = r.boundaries.lengthEnd(entry)
+	if err != nil {
+		r.err = err
+		return false
+	}
+	if entry.end < 0 {
+		// The length can't be right, so the body ends where the next message starts.
+		entry.end = r.boundaries.next(entry.bodyStart)
+		r.Reconstructed = append(r.Reconstructed, ContentLengthProblem{
+			Index:    r.count,
+			Offset:   entry.from,
+			Declared: entry.declared,
+			Actual:   entry.end - entry.bodyStart,
+		})
+	}
+
+	raw := make([]byte, entry.end-entry.from)
+	_, err = r.read.ReadAt(raw, entry.from)
+	if err != nil {
+		r.err = err
+		return false
+	}
+	from := strings.TrimRight(string(raw[:entry.headerAt-entry.from]), "\r\n")
+	raw = raw[entry.headerAt-entry.from:]
+	if r.Type == MBOXCL {
+		raw = unescapeFrom(raw)
+	}
+	r.msg = newMessage(from, raw, entry.from, entry.end-entry.from)
+	r.pos = entry.end
+	r.count++
+	return true
+}
+
+// Message provides the message read by the last call to Next.
+func (r *RecoveryReader) Message() *Message {
+	return r.msg
+}
+
+// Err provides the error that stopped Next, if any.
+func (r *RecoveryReader) Err() error {
+	return r.err
+}
+
+// unescapeFrom removes a '>' from each line of raw starting with one or more
+// '>' characters followed by 'From ', as mboxcl requires.
+func unescapeFrom(raw []byte) []byte {
+	re := regexp.MustCompile("(?m)^>(>*From )")
+	return re.ReplaceAll(raw, []byte("$1"))
+}
@@ -0,0 +1,76 @@
+package mbox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// recoveryMessage builds a message for a Content-Length mbox, declaring the
+// given length, or the body's real length if length is negative.
+func recoveryMessage(from string, subject string, body string, length int) string {
+	if length < 0 {
+		length = len(body)
+	}
+	return fmt.Sprintf("From %s Mon Jan  1 00:00:00 2024\nSubject: %s\nContent-Length: %d\n\n%s", from, subject, length, body)
+}
+
+func TestRecoveryReader(t *testing.T) {
+	forwarded := "Here's the mbox you wanted:\nFrom x@y Tue Jan  2 00:00:00 2024\n\n"
+	tests := []struct {
+		name          string
+		mboxType      int
+		mbox          string
+		bodies        []string
+		reconstructed []ContentLengthProblem
+	}{
+		{"long length", MBOXCL2,
+			recoveryMessage("a@b", "one", "body\n\n", 500) +
+				recoveryMessage("c@d", "two", "second\n\n", -1) +
+				recoveryMessage("e@f", "three", "third\n", -1),
+			[]string{"body\n\n", "second\n\n", "third\n"},
+			[]ContentLengthProblem{{Index: 0, Offset: 0, Declared: 500, Actual: 6}}},
+		{"short length", MBOXCL2,
+			recoveryMessage("a@b", "one", "body\nmore body\nFrom the top\n", 5) +
+				recoveryMessage("c@d", "two", "second\n", -1),
+			[]string{"body\nmore body\nFrom the top\n", "second\n"},
+			[]ContentLengthProblem{{Index: 0, Offset: 0, Declared: 5, Actual: 28}}},
+		{"missing length", MBOXCL2,
+			"From a@b Mon Jan  1 00:00:00 2024\nSubject: one\n\nbody\n" +
+				recoveryMessage("c@d", "two", "second\n", -1),
+			[]string{"body\n", "second\n"},
+			[]ContentLengthProblem{{Index: 0, Offset: 0, Declared: -1, Actual: 5}}},
+		{"trusted length", MBOXCL2,
+			recoveryMessage("a@b", "one", forwarded, -1) +
+				recoveryMessage("c@d", "two", "second\n", 900),
+			[]string{forwarded, "second\n"},
+			[]ContentLengthProblem{{Index: 1, Offset: int64(len(recoveryMessage("a@b", "one", forwarded, -1))), Declared: 900, Actual: 7}}},
+		{"escaped", MBOXCL,
+			recoveryMessage("a@b", "one", ">From the top\n>>From quoted\n", 99) +
+				recoveryMessage("c@d", "two", "second\n", -1),
+			[]string{"From the top\n>From quoted\n", "second\n"},
+			[]ContentLengthProblem{{Index: 0, Offset: 0, Declared: 99, Actual: 28}}},
+	}
+	for _, test := range tests {
+		reader, err := NewRecoveryReader(strings.NewReader(test.mbox), int64(len(test.mbox)), test.mboxType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies := []string{}
+		for reader.Next() {
+			body, _ := io.ReadAll(reader.Message().Body)
+			bodies = append(bodies, string(body))
+		}
+		if reader.Err() != nil {
+			t.Errorf("%s: %s", test.name, reader.Err())
+			continue
+		}
+		if fmt.Sprintf("%q", bodies) != fmt.Sprintf("%q", test.bodies) {
+			t.Errorf("%s: expected bodies %q but got %q", test.name, test.bodies, bodies)
+		}
+		if fmt.Sprint(reader.Reconstructed) != fmt.Sprint(test.reconstructed) {
+			t.Errorf("%s: expected %v reconstructed but got %v", test.name, test.reconstructed, reader.Reconstructed)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mbox
+
+import (
+	"encoding/csv"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// ParseGmailLabels reads the labels from the 'X-GM-LABELS' header found in
+// Gmail Takeout exports, or the 'X-Gmail-Labels' header that Takeout uses
+// too, if the former is missing.  The header separates labels with commas, quoting any
+// label holding a comma, and may encode labels as RFC 2047 words.
+func ParseGmailLabels(header mail.Header) (labels []string, err error) {
+	value := header.Get("X-GM-LABELS")
+	if len(strings.TrimSpace(value)) == 0 {
+		value = header.Get("X-Gmail-Labels")
+	}
+	if len(strings.TrimSpace(value)) == 0 {
+		return nil, nil
+	}
+	decoder := &mime.WordDecoder{}
+	decoded, err := decoder.DecodeHeader(value)
+	if err == nil {
+		value = decoded
+	}
+	reader := csv.NewReader(strings.NewReader(value))
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	fields, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if len(field) > 0 {
+			labels = append(labels, field)
+		}
+	}
+	return labels, nil
+}
+
+// takeoutFields fills in the Gmail fields of the message from its headers.
+func (msg *Message) takeoutFields() (err error) {
+	msg.Labels, err = ParseGmailLabels(msg.Header)
+	msg.ThreadID = strings.TrimSpace(msg.Header.Get("X-GM-THRID"))
+	return err
+}
+
+// SplitTakeout reads the Gmail Takeout mbox in src and writes each message
+// into one mbox per label it carries, so a message with three labels ends up
+// in three mboxes.  Messages without labels go to the mbox for the empty
+// label.  The srcType describes how to parse src, as with MboxReader.Type;
+// Takeout exports generally work best as MBOXRD.  The open function provides
+// the MboxWriter for a label, and gets called once for each label found.  It
+// returns the number of messages read.
+func SplitTakeout(src io.Reader, srcType int, open func(label string) (*MboxWriter, error)) (count int, err error) {
+	reader := NewReader(src)
+	reader.Type = srcType
+	reader.Takeout = true
+	writers := map[string]*MboxWriter{}
+	for reader.Next() {
+		msg := reader.Message()
+		count++
+		labels := msg.Labels
+		if len(labels) == 0 {
+			labels = []string{""}
+		}
+		for _, label := range labels {
+			writer, ok := writers[label]
+			if !ok {
+				writer, err = open(label)
+				if err != nil {
+					return count, err
+				}
+				writers[label] = writer
+			}
+			err = writer.WriteMail(msg.From, msg.Reader())
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, reader.Err()
+}
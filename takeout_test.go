@@ -0,0 +1,105 @@
+package mbox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var takeoutMbox string = `From 1590000000000000001@xxx Wed Feb 19 18:03:53 +0000 2020
+X-GM-THRID: 1658000000000000001
+X-Gmail-Labels: ignored
+X-GM-LABELS: Inbox,Important,"Work, mostly",=?UTF-8?Q?Caf=C3=A9?=
+From: bubbles@bubbletown.com
+Subject: Labelled
+
+>From all of us, to all of you, be happy!
+
+From 1590000000000000002@xxx Thu Feb 20 09:00:00 +0000 2020
+X-GM-THRID: 1658000000000000002
+X-Gmail-Labels: Inbox
+From: mrspam@corporate.corp.com
+Subject: Inbox only
+
+Buy now.
+
+From 1590000000000000003@xxx Thu Feb 20 10:00:00 +0000 2020
+From: nobody@nowhere.man
+Subject: No labels
+
+Boo.
+`
+
+func TestReaderTakeout(t *testing.T) {
+	box := NewReader(bytes.NewBufferString(takeoutMbox))
+	box.Type = MBOXRD
+	box.Takeout = true
+	if !box.Next() {
+		t.Fatal(box.Err())
+	}
+	msg := box.Message()
+	expected := []string{"Inbox", "Important", "Work, mostly", "Café"}
+	if strings.Join(msg.Labels, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v but got %v", expected, msg.Labels)
+	}
+	if msg.ThreadID != "1658000000000000001" {
+		t.Errorf("expected thread 1658000000000000001 but got %s", msg.ThreadID)
+	}
+	if msg.Addr != "1590000000000000001@xxx" {
+		t.Errorf("unexpected address %s", msg.Addr)
+	}
+	expectedTime := time.Date(2020, time.February, 19, 18, 3, 53, 0, time.UTC)
+	if !msg.Date.Equal(expectedTime) {
+		t.Errorf("expected %s but got %s", expectedTime, msg.Date)
+	}
+
+	// Without Takeout, the fields stay empty.
+	box = NewReader(bytes.NewBufferString(takeoutMbox))
+	box.Type = MBOXRD
+	box.Next()
+	if box.Message().Labels != nil || box.Message().ThreadID != "" {
+		t.Errorf("expected no Gmail fields")
+	}
+}
+
+func TestSplitTakeout(t *testing.T) {
+	outputs := map[string]*bytes.Buffer{}
+	count, err := SplitTakeout(bytes.NewBufferString(takeoutMbox), MBOXRD, func(label string) (*MboxWriter, error) {
+		if _, ok := outputs[label]; ok {
+			t.Errorf("label %s opened twice", label)
+		}
+		outputs[label] = bytes.NewBuffer([]byte{})
+		writer := NewWriter(outputs[label])
+		writer.Type = MBOXRD
+		return writer, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 messages but got %d", count)
+	}
+	if len(outputs) != 5 {
+		t.Errorf("expected 5 mboxes but got %d", len(outputs))
+	}
+	inbox, ok := outputs["Inbox"]
+	if !ok {
+		t.Fatalf("expected an Inbox mbox")
+	}
+	box := NewReader(inbox)
+	box.Type = MBOXRD
+	subjects := []string{}
+	for box.Next() {
+		subjects = append(subjects, box.Message().Header.Get("Subject"))
+	}
+	if strings.Join(subjects, "|") != "Labelled|Inbox only" {
+		t.Errorf("unexpected messages in Inbox: %v", subjects)
+	}
+	if !strings.HasPrefix(outputs["Work, mostly"].String(), "From 1590000000000000001@xxx Wed Feb 19 18:03:53 +0000 2020\n") {
+		t.Errorf("expected the From line to be preserved")
+	}
+	if !strings.Contains(outputs[""].String(), "Subject: No labels") {
+		t.Errorf("expected unlabelled messages under the empty label")
+	}
+}
@@ -14,16 +14,34 @@ import (
 // MboxWriter describes a writer for any of the mbox file types.
 // Use NewWriter to instantiate.  Set Type to specify the type.  Type is set to
 // MBOXO by default.
+//
+// For MBOXCL and MBOXCL2, the output depends on the destination.  When it can
+// seek, such as a file not opened for appending, MboxWriter writes each
+// 'Content-Length' value padded with spaces to 19 characters, and fills it in
+// once it has written the body.  Otherwise, it writes the value as is.  Set
+// NoSeek to always get the latter.
 type MboxWriter struct {
-	Type  int    // Specifies the type of MboxWriter, defaulting to MBOXO.
-	FS    FromFS // A filesystem for working with temporary files that handle MBOXCL/MBOXCL2 mboxes. Defaults to a FileFromFS.
-	write io.Writer
+	Type        int    // Specifies the type of MboxWriter, defaulting to MBOXO.
+	FS          FromFS // A filesystem for temporary files holding MBOXCL/MBOXCL2 bodies larger than MemoryLimit. Defaults to a FileFromFS.
+	MemoryLimit int64  // Specifies how many bytes of an MBOXCL/MBOXCL2 body to hold in memory before moving it to FS, defaulting to DefaultMemoryLimit.  A negative limit never uses FS.
+	Lossless    bool   // Specifies whether to write each mail exactly as given, as read by an MboxReader with Lossless set, so rewriting an unmodified mbox reproduces it.
+	LineEnding  int    // Specifies the line ending for the mbox, defaulting to PreserveLineEnding, which follows each mail's own line ending.
+	NoSeek      bool   // Specifies whether to hold MBOXCL/MBOXCL2 bodies in memory or FS even when the destination can seek, rather than filling in a padded 'Content-Length' afterwards.
+	write       io.Writer
+	eol         string // The line ending for lines we add to the mail being written.
+	babyl       *BabylWriter
+	tail        *tailWriter
 }
 
+// DefaultMemoryLimit describes how many bytes of an MBOXCL or MBOXCL2 body
+// NewWriter lets an MboxWriter hold in memory.
+const DefaultMemoryLimit = 1 << 20
+
 // FromFS describes an interface for providing a reader and writer independent
 // of the underlying file system.  Replace MboxWriter.FS with your own
 // implementation if needed.  MboxWriter uses this interface for working with
-// MBOXCL and MBOXCL2 files.
+// MBOXCL and MBOXCL2 files, when a body outgrows MboxWriter.MemoryLimit and the
+// destination can't seek.
 type FromFS interface {
 	OpenReader(from string) (result io.ReadCloser, err error)  // Opens a ReadCloser for the item specified by the 'from' field.
 	OpenWriter(from string) (result io.WriteCloser, err error) // Opens a WriteCloser for the item specified by the 'from' field.
@@ -41,7 +59,7 @@ type FileFromFS struct {
 // Subsequent calls to MBoxWriter.WriteMail() will write mbox-formatted output
 // to the writer provided to this function.
 func NewWriter(write io.Writer) (result *MboxWriter) {
-	return &MboxWriter{write: write, FS: NewFileFromFS("")}
+	return &MboxWriter{write: write, FS: NewFileFromFS(""), MemoryLimit: DefaultMemoryLimit}
 }
 
 // NewFileFromFS creates a new FileFromFS with the provided base folder.
@@ -59,9 +77,36 @@ func NewFileFromFS(base string) *FileFromFS {
 // The 'from' argument may come from a call to MboxReader.NextMessage(), or
 // a tool delivering the mail to the box.  The 'mail' argument contains the
 // bytes composing the mail (headers and body).
+// Unless LineEnding is PreserveLineEnding, every line gets the given line
+// ending, and any 'Content-Length' header counts the body that results.
 func (m *MboxWriter) WriteMail(from string, mail io.Reader) (err error) {
+	if m.Lossless && m.Type == BABYL {
+		return errBabylLossless
+	}
 	from = strings.TrimPrefix(from, "From ")
+	reader := bufio.NewReader(mail)
+	// A short peek just means a short mail.
+	sample, _ := reader.Peek(reader.Size())
+	m.eol = newline(m.LineEnding, lineEnding(sample))
+	mail = reader
+	if m.LineEnding != PreserveLineEnding {
+		mail = &lineEndingReader{read: reader, ending: m.LineEnding}
+	}
+	if m.Lossless {
+		m.trackTail()
+		if m.tail.unterminated {
+			// The 'From ' line must start a line of its own.
+			_, err = m.write.Write([]byte{'\n'})
+			if err != nil {
+				return err
+			}
+		}
+	}
 	switch m.Type {
+	case MMDF:
+		err = m.writeMMDFMail(from, mail)
+	case BABYL:
+		err = m.writeBabylMail(from, mail)
 	case MBOXCL2:
 		err = m.writeMBOXCL2Mail(from, mail)
 	case MBOXCL:
@@ -74,202 +119,377 @@ func (m *MboxWriter) WriteMail(from string, mail io.Reader) (err error) {
 	return err
 }
 
-// writeMBOXOMail writes the email using mboxo formatting.
-func (m *MboxWriter) writeMBOXOMail(from string, mail io.Reader) (err error) {
+// WritePreamble writes p to the mbox as it is, ahead of the next mail.  Give
+// it what MboxReader.Preamble provides, with Lossless set on both, to keep the
+// bytes of an mbox that belong to no message.
+func (m *MboxWriter) WritePreamble(p []byte) (err error) {
+	if m.Lossless {
+		m.trackTail()
+	}
+	_, err = m.write.Write(p)
+	return err
+}
+
+// trackTail starts keeping track of whether the mbox ends partway through a
+// line.
+func (m *MboxWriter) trackTail() {
+	if m.tail == nil {
+		m.tail = &tailWriter{Writer: m.write}
+		m.write = m.tail
+	}
+}
+
+// fromLine provides the 'From ' line starting the mail.  Lossless mode keeps
+// from as given, which holds the '\r' of a 'From ' line read from a CRLF mbox.
+func (m *MboxWriter) fromLine(from string) []byte {
+	if m.Lossless && m.LineEnding == PreserveLineEnding {
+		return []byte("From " + from + "\n")
+	}
+	return []byte("From " + strings.TrimSuffix(from, "\r") + m.eol)
+}
+
+// tailWriter remembers whether the last byte written to the mbox ended a
+// line.
+type tailWriter struct {
+	io.Writer
+	unterminated bool
+}
+
+// Write writes p to the underlying writer.
+func (t *tailWriter) Write(p []byte) (n int, err error) {
+	n, err = t.Writer.Write(p)
+	if n > 0 {
+		t.unterminated = p[n-1] != '\n'
+	}
+	return n, err
+}
+
+// writeEscaped copies the lines of mail to the mbox, prefixing each line
+// matching escape with '>'.  It provides the last line, which lacks a line
+// ending when mail does.
+func (m *MboxWriter) writeEscaped(mail io.Reader, escape *regexp.Regexp) (last []byte, err error) {
 	reader := bufio.NewReader(mail)
-	m.write.Write([]byte(fmt.Sprintf("From %s\n", from)))
-	b, err := reader.ReadBytes('\n')
-	for err == nil {
-		line := string(b)
-		if strings.HasPrefix(line, "From ") {
-			orig := b
-			b = []byte{'>'}
-			b = append(b, orig...)
+	for {
+		b, readErr := reader.ReadBytes('\n')
+		if escape.Match(b) {
+			b = append([]byte{'>'}, b...)
+		}
+		if len(b) > 0 {
+			last = b
 		}
 		_, err = m.write.Write(b)
 		if err != nil {
-			break
+			return last, err
+		}
+		if readErr == io.EOF {
+			return last, nil
 		}
-		b, err = reader.ReadBytes('\n')
+		if readErr != nil {
+			return last, readErr
+		}
+	}
+}
+
+// endMail finishes mail whose last line is last with a blank line, which
+// separates it from the next message.  In lossless mode, the mail already
+// holds whatever separated it from the next message, so it adds nothing.
+func (m *MboxWriter) endMail(last []byte) (err error) {
+	if m.Lossless {
+		return nil
 	}
-	if err == io.EOF {
-		m.write.Write([]byte{'\n'})
-		err = nil
+	end := m.eol
+	if len(last) > 0 && last[len(last)-1] != '\n' {
+		end += m.eol
 	}
+	_, err = m.write.Write([]byte(end))
 	return err
 }
 
+// writeMBOXOMail writes the email using mboxo formatting.
+func (m *MboxWriter) writeMBOXOMail(from string, mail io.Reader) (err error) {
+	_, err = m.write.Write(m.fromLine(from))
+	if err != nil {
+		return err
+	}
+	last, err := m.writeEscaped(mail, regexp.MustCompile("^From "))
+	if err != nil {
+		return err
+	}
+	return m.endMail(last)
+}
+
 func (m *MboxWriter) writeMBOXRDMail(from string, mail io.Reader) (err error) {
 	re, err := regexp.Compile("^>*From ")
 	if err != nil {
 		// This should only happen if I didn't unit test and got the regexp wrong.
 		panic(err)
 	}
+	_, err = m.write.Write(m.fromLine(from))
+	if err != nil {
+		return err
+	}
+	last, err := m.writeEscaped(mail, re)
+	if err != nil {
+		return err
+	}
+	return m.endMail(last)
+}
+
+func (m *MboxWriter) writeMBOXCLMail(from string, mail io.Reader) (err error) {
+	re, err := regexp.Compile("^>*From ")
+	if err != nil {
+		// This should only happen if I didn't unit test and got the regexp wrong.
+		panic(err)
+	}
+	return m.writeContentLengthMail(from, mail, re)
+}
+
+func (m *MboxWriter) writeMBOXCL2Mail(from string, mail io.Reader) (err error) {
+	return m.writeContentLengthMail(from, mail, nil)
+}
+
+// writeContentLengthMail writes the email with a 'Content-Length' header
+// giving the size of its body, as mboxcl and mboxcl2 need.  It prefixes
+// lines matching escape with '>', unless escape is nil.
+func (m *MboxWriter) writeContentLengthMail(from string, mail io.Reader, escape *regexp.Regexp) (err error) {
+	// We need to know the size of the body, after we've modified it to handle
+	// 'From ', before we can write the 'Content-Length' header ahead of it.
+	// When the destination can seek, we write a placeholder of a fixed width
+	// and fill it in once we've written the body.  Otherwise, we hold the body
+	// in memory, up to MemoryLimit bytes, then move it to a temporary stream
+	// from FS, which one may replace, not knowing how someone might want to
+	// use this library.
+	_, err = m.write.Write(m.fromLine(from))
+	if err != nil {
+		return err
+	}
+	// The header is small enough to hold while we count the body.
+	header := &bytes.Buffer{}
+	var blank, length []byte
+	lengthAt := 0
 	reader := bufio.NewReader(mail)
-	m.write.Write([]byte(fmt.Sprintf("From %s\n", from)))
-	b, err := reader.ReadBytes('\n')
-	for err == nil {
-		if re.Match(b) {
-			orig := b
-			b = []byte{'>'}
-			b = append(b, orig...)
+	more := true
+	for more {
+		b, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
 		}
-		_, err = m.write.Write(b)
-		if err != nil {
+		more = readErr == nil
+		if len(b) == 0 {
 			break
 		}
-		b, err = reader.ReadBytes('\n')
+		if !more {
+			// The mail lacks a final line ending, which only lossless mode
+			// keeps, and then only in the body.
+			b = append(b, m.eol...)
+		}
+		if escape != nil && escape.Match(b) {
+			b = append([]byte{'>'}, b...)
+		}
+		switch {
+		case isBlankLine(b):
+			// Might be \r\n or \n.  We are about to write the body.
+			blank = b
+			more = false
+		case m.Lossless && length == nil && isContentLength(string(b)):
+			// We'll correct the existing header rather than add another.
+			lengthAt = header.Len()
+			length = b
+			header.Write(b)
+		case !m.Lossless && isContentLength(string(b)):
+			// We'll add our own, which counts the body as we write it.
+		default:
+			header.Write(b)
+		}
 	}
-	if err == io.EOF {
-		m.write.Write([]byte{'\n'})
-		err = nil
+	if blank == nil {
+		blank = []byte(m.eol)
 	}
-	return err
-}
 
-func (m *MboxWriter) writeMBOXCLMail(from string, mail io.Reader) (err error) {
-	// We need to know, in advance, the size of the message to write, after we've
-	// modified it to handle 'From '.  The safest way to do this requires writing
-	// to a file first to get the resulting size, then authoring the Content-Length
-	// header, and copying the contents of that file to the write stream.
-	// Otherwise, the size of the body might consume available RAM.
-	// But, I don't like depending on a file system at all, not knowing how someone
-	// might want to use this library.  So, I chose an approach that uses helper
-	// functions that one may replace to acquire the temporary io.Writer/io.Reader
-	// objects.  The library will provide a reasonable default that most would
-	// likely use.
-	tmpWriter, err := m.FS.OpenWriter(from)
+	if seeker := m.seeker(); seeker != nil && !m.Lossless && !m.NoSeek {
+		return m.writePatchedBody(seeker, header.Bytes(), blank, reader, escape)
+	}
+
+	spool := &bodySpool{fs: m.FS, from: from, limit: m.MemoryLimit}
+	defer spool.Close()
+	count, blanks, err := m.writeBody(spool, reader, escape)
 	if err != nil {
-		return fmt.Errorf("unable to open temporary stream: %s", err)
+		return err
 	}
-	defer func() {
-		tmpWriter.Close()
-		m.FS.Remove(from)
-	}()
 
-	re, err := regexp.Compile("^>*From ")
+	raw := header.Bytes()
+	// Lossless mode leaves a mail without a length alone, as the body then
+	// runs to the next 'From ' line.
+	switch {
+	case !m.Lossless:
+		raw = append(raw, []byte(fmt.Sprintf("Content-Length: %d%s", count, m.eol))...)
+	case length != nil:
+		// A length that leaves out the blank lines separating the body from
+		// the next message, as most writers do, is also right.
+		if declared, err := parseContentLength(string(length)); err != nil || (declared != count && declared != count-blanks) {
+			fixed := []byte(fmt.Sprintf("Content-Length: %d%s", count, lineEnding(length)))
+			raw = append(append(append([]byte{}, raw[:lengthAt]...), fixed...), raw[lengthAt+len(length):]...)
+		}
+	}
+	raw = append(raw, blank...)
+	_, err = m.write.Write(raw)
 	if err != nil {
-		// This should only happen if I didn't unit test and got the regexp wrong.
-		panic(err)
+		return err
 	}
-	inHeader := true
-	reader := bufio.NewReader(mail)
-	m.write.Write([]byte(fmt.Sprintf("From %s\n", from)))
-	b, err := reader.ReadBytes('\n')
-	count := int64(0)
-	for err == nil {
-		if re.Match(b) {
-			orig := b
-			b = []byte{'>'}
-			b = append(b, orig...)
+	_, err = spool.WriteTo(m.write)
+	return err
+}
+
+// writeBody copies the body of a mail from reader to write, prefixing lines
+// matching escape with '>', unless escape is nil.  It provides the number of
+// bytes written, and how many of those belong to blank lines at the end.
+func (m *MboxWriter) writeBody(write io.Writer, reader *bufio.Reader, escape *regexp.Regexp) (count int64, blanks int64, err error) {
+	for {
+		b, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return count, blanks, readErr
 		}
-		l := len(b)
-		if inHeader {
-			if l <= 2 && len(strings.TrimSpace(string(b))) == 0 {
-				// We are about to write the body.
-				inHeader = false
-				b, err = reader.ReadBytes('\n')
-				continue
-			}
-			_, err = m.write.Write(b)
-			if err != nil {
-				return err
-			}
-			b, err = reader.ReadBytes('\n')
-			continue
+		if len(b) == 0 {
+			return count, blanks, nil
 		}
-		// If we made it here, we aren't in the header anymore.
-		count += int64(l)
-		_, err = tmpWriter.Write(b)
-		if err != nil {
-			return err
+		if readErr == io.EOF && !m.Lossless {
+			b = append(b, m.eol...)
+		}
+		if escape != nil && escape.Match(b) {
+			b = append([]byte{'>'}, b...)
+		}
+		n, err := write.Write(b)
+		count += int64(n)
+		if isBlankLine(b) {
+			blanks += int64(n)
+		} else {
+			blanks = 0
+		}
+		if err != nil || readErr == io.EOF {
+			return count, blanks, err
 		}
-		b, err = reader.ReadBytes('\n')
 	}
-	if err == io.EOF {
-		err = nil
+}
+
+// contentLengthWidth holds the number of digits in the largest possible
+// 'Content-Length' value, so a placeholder has room for any length.
+const contentLengthWidth = 19
+
+// seeker provides the destination if we can go back and fill in a
+// 'Content-Length' placeholder, or nil if we can't.
+func (m *MboxWriter) seeker() io.WriteSeeker {
+	seeker, ok := m.write.(io.WriteSeeker)
+	if !ok {
+		return nil
 	}
-	if err == nil {
-		var tmpReader io.ReadCloser
-		tmpWriter.Close()
-		m.write.Write([]byte(fmt.Sprintf("Content-Length: %d\n\n", count)))
-		tmpReader, err = m.FS.OpenReader(from)
+	if file, ok := m.write.(*os.File); ok {
+		// A file opened for appending writes to its end no matter where we
+		// seek, but refuses WriteAt, so we find out by trying.
+		_, err := file.WriteAt(nil, 0)
 		if err != nil {
-			return err
+			return nil
 		}
-		defer tmpReader.Close()
-		_, err = io.Copy(m.write, tmpReader)
 	}
-	return err
+	// Pipes and the like claim to seek, but fail when asked.
+	_, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	return seeker
 }
 
-func (m *MboxWriter) writeMBOXCL2Mail(from string, mail io.Reader) (err error) {
-	// We need to know, in advance, the size of the message to write, after we've
-	// modified it to handle 'From '.  The safest way to do this requires writing
-	// to a file first to get the resulting size, then authoring the Content-Length
-	// header, and copying the contents of that file to the write stream.
-	// Otherwise, the size of the body might consume available RAM.
-	// But, I don't like depending on a file system at all, not knowing how someone
-	// might want to use this library.  So, I chose an approach that uses helper
-	// functions that one may replace to acquire the temporary io.Writer/io.Reader
-	// objects.  The library will provide a reasonable default that most would
-	// likely use.
-	tmpWriter, err := m.FS.OpenWriter(from)
+// writePatchedBody writes the header followed by a 'Content-Length'
+// placeholder and the blank line ending the header, then the body from
+// reader, then fills in the placeholder with the size of the body.
+func (m *MboxWriter) writePatchedBody(seeker io.WriteSeeker, header []byte, blank []byte, reader *bufio.Reader, escape *regexp.Regexp) (err error) {
+	_, err = seeker.Write(header)
+	if err != nil {
+		return err
+	}
+	_, err = seeker.Write([]byte("Content-Length: "))
 	if err != nil {
-		return fmt.Errorf("unable to open temporary stream: %s", err)
+		return err
 	}
-	defer func() {
-		tmpWriter.Close()
-		m.FS.Remove(from)
-	}()
+	placeholder, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = seeker.Write(append([]byte(fmt.Sprintf("%*d%s", contentLengthWidth, 0, m.eol)), blank...))
+	if err != nil {
+		return err
+	}
+	count, _, err := m.writeBody(seeker, reader, escape)
+	if err != nil {
+		return err
+	}
+	end, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = seeker.Seek(placeholder, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = seeker.Write([]byte(fmt.Sprintf("%*d", contentLengthWidth, count)))
+	if err != nil {
+		return err
+	}
+	_, err = seeker.Seek(end, io.SeekStart)
+	return err
+}
 
-	inHeader := true
-	reader := bufio.NewReader(mail)
-	m.write.Write([]byte(fmt.Sprintf("From %s\n", from)))
-	b, err := reader.ReadBytes('\n')
-	count := int64(0)
-	for err == nil {
-		l := len(b)
-		if inHeader {
-			// Might be \r\n or \n.
-			if l <= 2 &&
-				len(strings.TrimSpace(string(b))) == 0 &&
-				!bytes.ContainsAny(b, " \t") {
-				// We are about to write the body.
-				inHeader = false
-				b, err = reader.ReadBytes('\n')
-				continue
-			}
-			_, err = m.write.Write(b)
-			if err != nil {
-				return err
-			}
-			b, err = reader.ReadBytes('\n')
-			continue
+// bodySpool holds a body in memory until it grows past limit, then moves it
+// to a temporary stream from fs.  A negative limit keeps it all in memory.
+type bodySpool struct {
+	fs     FromFS
+	from   string
+	limit  int64
+	memory bytes.Buffer
+	file   io.WriteCloser // The temporary stream, once the body outgrows memory.
+}
+
+// Write adds p to the body.
+func (s *bodySpool) Write(p []byte) (n int, err error) {
+	if s.file == nil && s.limit >= 0 && int64(s.memory.Len()+len(p)) > s.limit {
+		s.file, err = s.fs.OpenWriter(s.from)
+		if err != nil {
+			s.file = nil
+			return 0, fmt.Errorf("unable to open temporary stream: %s", err)
 		}
-		// If we made it here, we aren't in the header anymore.
-		count += int64(l)
-		_, err = tmpWriter.Write(b)
+		_, err = s.file.Write(s.memory.Bytes())
 		if err != nil {
-			return err
+			return 0, err
 		}
-		b, err = reader.ReadBytes('\n')
+		s.memory.Reset()
 	}
-	if err == io.EOF {
-		err = nil
+	if s.file != nil {
+		return s.file.Write(p)
 	}
-	if err == nil {
-		var tmpReader io.ReadCloser
-		tmpWriter.Close()
-		m.write.Write([]byte(fmt.Sprintf("Content-Length: %d\n\n", count)))
-		tmpReader, err = m.FS.OpenReader(from)
-		if err != nil {
-			return err
-		}
-		defer tmpReader.Close()
-		_, err = io.Copy(m.write, tmpReader)
+	return s.memory.Write(p)
+}
+
+// WriteTo copies the body to write.
+func (s *bodySpool) WriteTo(write io.Writer) (n int64, err error) {
+	if s.file == nil {
+		return s.memory.WriteTo(write)
 	}
-	return err
+	s.file.Close()
+	reader, err := s.fs.OpenReader(s.from)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return io.Copy(write, reader)
+}
+
+// Close removes any temporary stream.
+func (s *bodySpool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	s.file = nil
+	return s.fs.Remove(s.from)
 }
 
 func (f *FileFromFS) getPattern(from string) (result string) {
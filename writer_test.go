@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/kylelemons/godebug/diff"
@@ -335,6 +337,7 @@ Do you remember?
 func TestBrokenWriteFS(t *testing.T) {
 	result := bytes.NewBuffer([]byte{})
 	mbox := NewWriter(result)
+	mbox.MemoryLimit = 0
 	mbox.FS = &BrokenFS{BreakWriter: true}
 	mbox.Type = MBOXCL2
 	err := mbox.WriteMail(from1, bytes.NewBuffer([]byte(email1)))
@@ -350,6 +353,7 @@ func TestBrokenWriteFS(t *testing.T) {
 func TestBrokenReadFS(t *testing.T) {
 	result := bytes.NewBuffer([]byte{})
 	mbox := NewWriter(result)
+	mbox.MemoryLimit = 0
 	mbox.FS = &BrokenFS{BreakReader: true}
 	mbox.Type = MBOXCL2
 	err := mbox.WriteMail(from1, bytes.NewBuffer([]byte(email1)))
@@ -377,3 +381,233 @@ func TestFileFromFSOrder(t *testing.T) {
 		t.Errorf("expected error, but succeeded")
 	}
 }
+
+func TestWriteUnterminatedMail(t *testing.T) {
+	result := bytes.NewBuffer([]byte{})
+	mbox := NewWriter(result)
+	err := mbox.WriteMail(from3, bytes.NewBufferString("Subject: Cut short\n\nNo final line ending"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "From nobody@nowhere.man\nSubject: Cut short\n\nNo final line ending\n\n"
+	CompareBodies(expected, result.String(), t)
+}
+
+var losslessMboxes = []struct {
+	name     string
+	mboxType int
+	original string
+}{
+	{"mboxo", MBOXO, "From a@b Mon Jan  1 00:00:00 2024\nSubject: one\n\n>From the top\n\n\nFrom c@d Mon Jan  1 00:00:00 2024\nSubject: two\n\nlast"},
+	{"mboxo crlf", MBOXO, "From a@b Mon Jan  1 00:00:00 2024\r\nSubject: one\r\n\r\nbody\r\n\r\nFrom c@d Mon Jan  1 00:00:00 2024\r\nSubject: two\r\n\r\nlast\r\n\r\n"},
+	{"mboxo no separator", MBOXO, "From a@b Mon Jan  1 00:00:00 2024\nSubject: one\n\nbody\nFrom c@d Mon Jan  1 00:00:00 2024\nSubject: two\n\nlast\n"},
+	{"mboxrd", MBOXRD, "From a@b Mon Jan  1 00:00:00 2024\nSubject: one\n\n>From the top\n>>From quoted\n\nFrom c@d Mon Jan  1 00:00:00 2024\nSubject: two\n\nlast"},
+	{"mboxrd crlf", MBOXRD, "From a@b Mon Jan  1 00:00:00 2024\r\nSubject: one\r\n\r\n>From the top\r\n\r\nFrom c@d Mon Jan  1 00:00:00 2024\r\nSubject: two\r\n\r\nlast\r\n"},
+	{"mboxcl", MBOXCL, "From a@b Mon Jan  1 00:00:00 2024\nSubject: one\nContent-Length: 20\n\n>From the top\nmore\n\nFrom c@d Mon Jan  1 00:00:00 2024\nContent-Length: 4\nSubject: two\n\nlast"},
+	{"mboxcl crlf", MBOXCL, "From a@b Mon Jan  1 00:00:00 2024\r\nSubject: one\r\nContent-Length: 23\r\n\r\n>From the top\r\nmore\r\n\r\n"},
+	{"mboxcl2", MBOXCL2, "From a@b Mon Jan  1 00:00:00 2024\nSubject: one\nContent-Length: 19\n\nFrom the top\nmore\n\nFrom c@d Mon Jan  1 00:00:00 2024\nContent-Length: 4\nSubject: two\n\nlast"},
+	{"mboxcl2 crlf", MBOXCL2, "From a@b Mon Jan  1 00:00:00 2024\r\nContent-Length: 8\r\nSubject: one\r\n\r\nbody\r\n\r\nFrom c@d Mon Jan  1 00:00:00 2024\r\nContent-Length: 8\r\nSubject: two\r\n\r\nlast\r\n\r\n"},
+	// Most writers leave the separating blank line out of the length.
+	{"mboxcl separate", MBOXCL, "From a@b Mon Jan  1 00:00:00 2024\nSubject: one\nContent-Length: 19\n\n>From the top\nmore\n\nFrom c@d Mon Jan  1 00:00:00 2024\nContent-Length: 9\nSubject: two\n\nOne body\n\n"},
+	{"mboxcl separate crlf", MBOXCL, "From a@b Mon Jan  1 00:00:00 2024\r\nContent-Length: 10\r\n\r\nTwo body\r\n\r\nFrom c@d Mon Jan  1 00:00:00 2024\r\nContent-Length: 6\r\n\r\nlast\r\n\r\n"},
+	{"mboxcl2 separate", MBOXCL2, "From a@b Mon Jan  1 00:00:00 2024\nSubject: one\nContent-Length: 18\n\nFrom the top\nmore\n\nFrom c@d Mon Jan  1 00:00:00 2024\nContent-Length: 9\nSubject: two\n\nOne body\n\n"},
+	{"mboxcl2 separate crlf", MBOXCL2, "From a@b Mon Jan  1 00:00:00 2024\r\nContent-Length: 10\r\nSubject: one\r\n\r\nTwo body\r\n\r\n\r\nFrom c@d Mon Jan  1 00:00:00 2024\r\nContent-Length: 6\r\n\r\nlast\r\n"},
+	{"mboxcl2 no length", MBOXCL2, "From a@b Mon Jan  1 00:00:00 2024\nS: x\n\nhi\n\nFrom c@d Mon Jan  1 00:00:00 2024\nContent-Length: 5\n\nlast\n"},
+	{"mboxo preamble", MBOXO, "Junk ahead of the mail\n\nFrom a@b Mon Jan  1 00:00:00 2024\nSubject: one\n\nbody\n"},
+	{"mboxcl2 preamble crlf", MBOXCL2, "\r\nJunk\r\nFrom a@b Mon Jan  1 00:00:00 2024\r\nContent-Length: 6\r\n\r\nbody\r\n\r\n"},
+	{"mmdf", MMDF, mmdfBox},
+	{"mmdf crlf", MMDF, "Junk\r\n\x01\x01\x01\x01\r\nFrom a@b Mon Jan  1 00:00:00 2024\r\nSubject: one\r\n\r\nbody\r\n\x01\x01\x01\x01\r\n\x01\x01\x01\x01\r\nSubject: two\r\n\r\nlast\r\n\x01\x01\x01\x01\r\n\r\n"},
+}
+
+func TestLosslessRoundTrip(t *testing.T) {
+	for _, test := range losslessMboxes {
+		reader := NewReader(bytes.NewBufferString(test.original))
+		reader.Type = test.mboxType
+		reader.Lossless = true
+		result := bytes.NewBuffer([]byte{})
+		writer := NewWriter(result)
+		writer.Type = test.mboxType
+		writer.Lossless = true
+		for {
+			msg := bytes.NewBuffer([]byte{})
+			from, err := reader.NextMessage(msg)
+			writeErr := writer.WritePreamble(reader.Preamble())
+			if writeErr != nil {
+				t.Fatalf("%s: %s", test.name, writeErr)
+			}
+			if len(from) > 0 {
+				writeErr := writer.WriteMail(from, msg)
+				if writeErr != nil {
+					t.Fatalf("%s: %s", test.name, writeErr)
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+		}
+		if result.String() != test.original {
+			t.Errorf("%s: round trip changed the mbox\n%s", test.name, diff.Diff(test.original, result.String()))
+		}
+	}
+}
+
+func TestLosslessContentLength(t *testing.T) {
+	result := bytes.NewBuffer([]byte{})
+	writer := NewWriter(result)
+	writer.Type = MBOXCL2
+	writer.Lossless = true
+	err := writer.WriteMail(from1, bytes.NewBufferString("Content-Length: 99\r\nSubject: one\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteMail(from2, bytes.NewBufferString("Subject: two\n\nbody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "From bubbles@bubbletown.com\nContent-Length: 6\r\nSubject: one\r\n\r\nbody\r\n" +
+		"From mrspam@corporate.corp.com\nSubject: two\n\nbody"
+	CompareBodies(expected, result.String(), t)
+}
+
+// countingFS counts the temporary streams MboxWriter opens.
+type countingFS struct {
+	*FileFromFS
+	opened int
+}
+
+func (c *countingFS) OpenWriter(from string) (result io.WriteCloser, err error) {
+	c.opened++
+	return c.FileFromFS.OpenWriter(from)
+}
+
+func TestWriteContentLengthMemoryLimit(t *testing.T) {
+	for _, limit := range []int64{-1, 0, 10, DefaultMemoryLimit} {
+		result := bytes.NewBuffer([]byte{})
+		writer := NewWriter(result)
+		writer.Type = MBOXCL
+		writer.MemoryLimit = limit
+		fs := &countingFS{FileFromFS: NewFileFromFS(t.TempDir())}
+		writer.FS = fs
+		err := writer.WriteMail(from4, bytes.NewBufferString(email4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedOpened := 0
+		if limit >= 0 && limit < 50 {
+			expectedOpened = 1
+		}
+		if fs.opened != expectedOpened {
+			t.Errorf("limit %d: expected %d temporary streams but got %d", limit, expectedOpened, fs.opened)
+		}
+		expected := `From corrupter@argh.net
+From: corrupter@argh.net
+To: mrmxpdstk@lazytown.com
+Subject: Ah, ha ha ha ha!
+Content-Length: 78
+
+I remember when you wrote:
+
+>>From then on, I was a genius.
+
+Do you remember?
+`
+		CompareBodies(expected, result.String(), t)
+	}
+}
+
+func TestWriteContentLengthSeeker(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "seek*.mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := NewWriter(file)
+	writer.Type = MBOXCL2
+	// Seeking needs no temporary streams at all.
+	writer.MemoryLimit = 0
+	writer.FS = &BrokenFS{BreakWriter: true, BreakReader: true}
+	for _, email := range []string{email1, email2, email4, "Content-Length: 3\nSubject: Stale\n\nbody\n"} {
+		err = writer.WriteMail(from1, bytes.NewBufferString(email))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(raw, []byte(fmt.Sprintf("Content-Length: %19d\n", 41))) {
+		t.Errorf("expected a padded Content-Length in\n%s", raw)
+	}
+	// The stale length makes way for the one we fill in.
+	if count := bytes.Count(raw, []byte("Content-Length:")); count != 4 {
+		t.Errorf("expected 4 Content-Length headers but got %d in\n%s", count, raw)
+	}
+	reader := NewReader(bytes.NewReader(raw))
+	reader.Type = MBOXCL2
+	bodies := []string{}
+	for reader.Next() {
+		body, _ := io.ReadAll(reader.Message().Body)
+		bodies = append(bodies, string(body))
+	}
+	if reader.Err() != nil {
+		t.Fatal(reader.Err())
+	}
+	if len(bodies) != 4 || bodies[2] != "I remember when you wrote:\n\n>From then on, I was a genius.\n\nDo you remember?\n" {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+}
+
+func TestWriteContentLengthNoSeek(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "noseek*.mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := NewWriter(file)
+	writer.Type = MBOXCL2
+	writer.NoSeek = true
+	err = writer.WriteMail(from1, bytes.NewBufferString(email1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file matches what a bytes.Buffer would get.
+	expected := bytes.NewBuffer([]byte{})
+	writer = NewWriter(expected)
+	writer.Type = MBOXCL2
+	err = writer.WriteMail(from1, bytes.NewBufferString(email1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareBodies(expected.String(), string(raw), t)
+}
+
+func TestWriteContentLengthAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "append.mbox")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := NewWriter(file)
+	writer.Type = MBOXCL2
+	err = writer.WriteMail(from1, bytes.NewBufferString(email1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// We can't fill in a placeholder in a file opened for appending.
+	if !bytes.Contains(raw, []byte("Content-Length: 41\n")) {
+		t.Errorf("expected an unpadded Content-Length in\n%s", raw)
+	}
+}